@@ -4,44 +4,134 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/spf13/pflag"
+	"github.com/utain/kroki-mcp/internal/auth"
+	"github.com/utain/kroki-mcp/internal/cache"
 	"github.com/utain/kroki-mcp/internal/config"
+	"github.com/utain/kroki-mcp/internal/health"
 	"github.com/utain/kroki-mcp/internal/kroki"
 	"github.com/utain/kroki-mcp/internal/mcp"
+	"github.com/utain/kroki-mcp/internal/metrics"
+	"github.com/utain/kroki-mcp/internal/model"
+	"github.com/utain/kroki-mcp/internal/svgconv"
+	"github.com/utain/kroki-mcp/internal/telemetry"
 )
 
 func main() {
-	var cfg config.Config
-
-	pflag.StringVarP(&cfg.ServerHost, "host", "h", "localhost", "Server host")
-	pflag.IntVarP(&cfg.ServerPort, "port", "p", 5090, "Server port")
-	pflag.StringVarP(&cfg.ServerMode, "mode", "m", "stdio", "Operation mode: sse or stdio (default)")
-	pflag.StringVarP(&cfg.OutputFormat, "format", "f", "png", "Output format: png, svg")
-	pflag.StringVar(&cfg.KrokiHost, "kroki-host", "https://kroki.io", "Kroki server host URL")
-	pflag.StringVar(&cfg.LogLevel, "log-level", "info", "Log level: debug, info, warn, error")
-	pflag.StringVar(&cfg.LogFormat, "log-format", "text", "Log format: text or json")
-
-	pflag.Parse()
+	cfg, fs, err := loadConfig(os.Args[1:])
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	if printConfig, _ := fs.GetBool(config.PrintFlag); printConfig {
+		if err := config.Print(os.Stdout, fs); err != nil {
+			slog.Error("Failed to print configuration", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	logger := config.InitLogger(cfg.LogLevel, cfg.LogFormat)
 	logger.Info("Kroki-MCP starting...",
 		"mode", cfg.ServerMode,
 		"format", cfg.OutputFormat,
 		"krokiHost", cfg.KrokiHost,
+		"krokiBackends", cfg.KrokiBackends,
 		"logLevel", cfg.LogLevel,
 		"logFormat", cfg.LogFormat,
 		"serverHost", cfg.ServerHost,
 		"serverPort", cfg.ServerPort,
+		"krokiTimeout", cfg.KrokiTimeout,
+		"krokiProxy", cfg.KrokiProxy,
+		"krokiCACert", cfg.KrokiCACert,
+		"krokiClientCert", cfg.KrokiClientCert,
+		"krokiInsecureSkipVerify", cfg.KrokiInsecureSkipVerify,
+		"krokiMaxAttempts", cfg.KrokiMaxAttempts,
+		"krokiBreakerThreshold", cfg.KrokiBreakerThreshold,
+		"cacheEntries", cfg.CacheEntries,
+		"cacheDir", cfg.CacheDir,
+		"authTokenFile", cfg.AuthTokenFile,
+		"authEnvTokens", len(cfg.AuthTokens),
+		"authJWKS", cfg.AuthJWKS,
+		"traceExporter", cfg.TraceExporter,
 	)
+	if err := validateConfig(cfg); err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	shutdownTracing, err := telemetry.Setup(context.Background(), telemetry.Options{
+		Exporter:       cfg.TraceExporter,
+		Endpoint:       cfg.TraceEndpoint,
+		SampleRatio:    cfg.TraceSampleRatio,
+		ServiceVersion: version,
+	})
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	// Flush the spans still batched when the server stops.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+	}()
+	if cfg.KrokiInsecureSkipVerify {
+		logger.Warn("TLS certificate verification for the Kroki server is disabled")
+	}
 
-	krokiClient := kroki.NewKrokiClient(cfg.KrokiHost)
-	kroki := mcp.NewKrokiMCPServer(&cfg, krokiClient)
+	// Metrics are only exposed, and so only collected, in the network modes.
+	var m *metrics.Metrics
+	if cfg.ServerMode != "stdio" {
+		m = metrics.New()
+	}
+
+	krokiClient, err := newKrokiClient(cfg, m)
+	if err != nil {
+		logger.Error("Failed to configure Kroki client", "error", err)
+		os.Exit(1)
+	}
+	var renderCache cache.Tiered
+	if cfg.CacheEntries > 0 {
+		renderCache = append(renderCache, cache.NewMemory(cfg.CacheEntries))
+	}
+	if cfg.CacheDir != "" {
+		disk, err := cache.NewDisk(cfg.CacheDir, cfg.CacheDirMaxBytes, cfg.CacheTTL)
+		if err != nil {
+			logger.Error("Failed to open render cache directory", "error", err)
+			os.Exit(1)
+		}
+		renderCache = append(renderCache, disk)
+	}
+	opts := []mcp.ServerOption{mcp.WithMetrics(m)}
+	if len(renderCache) > 0 {
+		opts = append(opts, mcp.WithRenderCache(renderCache))
+	}
+
+	kroki := mcp.NewKrokiMCPServer(cfg, krokiClient, opts...)
+	reloader := newReloader(logger, os.Args[1:], fs, kroki, m)
+	reloader.watch(context.Background())
+	if cfg.DiscoveryInterval > 0 {
+		go kroki.WatchDiagramTypes(context.Background(), cfg.DiscoveryInterval)
+	}
 	switch cfg.ServerMode {
 	case "stdio":
 		logger.Info("STDIO mode: reading diagram type and source from stdin")
+		if cfg.AuthTokenFile != "" || len(cfg.AuthTokens) > 0 || cfg.AuthJWKS != "" {
+			logger.Warn("Authentication settings are ignored in stdio mode")
+		}
 		// ServeStdio installs its own SIGTERM/SIGINT handler and cancels the
 		// listen context on signal, so a graceful shutdown surfaces as
 		// context.Canceled rather than a real failure.
@@ -50,14 +140,333 @@ func main() {
 			os.Exit(1)
 		}
 	default:
-		logger.Info("SSE mode: starting SSE server")
-		sseServer := server.NewSSEServer(kroki.Handler())
-		logger.Info("SSE server started successfully", "host", cfg.ServerHost, "port", cfg.ServerPort)
-		if err := sseServer.Start(fmt.Sprintf("%s:%d", cfg.ServerHost, cfg.ServerPort)); err != nil {
-			logger.Error("Failed to start SSE server", "error", err)
-			os.Exit(1)
+		serveHTTP(logger, cfg, kroki, m)
+	}
+}
+
+// newFlagSet defines the command-line flags, each bound to a field of cfg.
+func newFlagSet(cfg *config.Config) *pflag.FlagSet {
+	fs := pflag.NewFlagSet("kroki-mcp", pflag.ExitOnError)
+	fs.StringVarP(&cfg.ServerHost, "host", "h", "localhost", "Server host")
+	fs.IntVarP(&cfg.ServerPort, "port", "p", 5090, "Server port")
+	fs.StringVarP(&cfg.ServerMode, "mode", "m", "stdio", "Operation mode: stdio (default), sse or http (Streamable HTTP)")
+	fs.StringVarP(&cfg.OutputFormat, "format", "f", "", "Default output format when a tool call omits one: "+strings.Join(model.SupportedOutputFormats, ", ")+" (default: svg for generate_diagram, png for get_diagram_url)")
+	fs.StringVar(&cfg.KrokiHost, "kroki-host", "https://kroki.io", "Kroki server host URL")
+	fs.StringSliceVar(&cfg.DiagramTypes, "diagram-types", nil, "Diagram types the tools accept, e.g. plantuml,mermaid (default: all supported)")
+	fs.StringVar(&cfg.SVGSanitize, "svg-sanitize", "standard", "Sanitize policy for the SVG generate_diagram returns inline: strict (no foreignObject HTML labels), standard, relaxed (keeps external links and images) or off")
+	fs.StringArrayVar(&cfg.KrokiBackends, "kroki-backend", nil, "Additional Kroki server as URL[;types=TYPE,...][;public][;fallback] (repeatable)")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Log level: debug, info, warn, error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "text", "Log format: text or json")
+	fs.DurationVar(&cfg.KrokiTimeout, "kroki-timeout", 60*time.Second, "Timeout for a whole Kroki request (0 disables)")
+	fs.DurationVar(&cfg.KrokiDialTimeout, "kroki-dial-timeout", 10*time.Second, "Timeout for connecting to the Kroki server")
+	fs.DurationVar(&cfg.KrokiIdleConnTimeout, "kroki-idle-timeout", 90*time.Second, "How long idle connections to the Kroki server are kept open")
+	fs.StringVar(&cfg.KrokiProxy, "kroki-proxy", "", "Proxy URL for Kroki requests (default: HTTP_PROXY/HTTPS_PROXY environment)")
+	fs.StringVar(&cfg.KrokiCACert, "kroki-ca-cert", "", "PEM CA bundle to trust for the Kroki server, in addition to the system roots")
+	fs.StringVar(&cfg.KrokiClientCert, "kroki-client-cert", "", "PEM client certificate for mTLS to the Kroki server")
+	fs.StringVar(&cfg.KrokiClientKey, "kroki-client-key", "", "PEM private key for --kroki-client-cert")
+	fs.IntVar(&cfg.KrokiMaxAttempts, "kroki-max-attempts", 3, "Attempts per Kroki render, including the first; network errors, 429 and 5xx are retried")
+	fs.DurationVar(&cfg.KrokiRetryBackoff, "kroki-retry-backoff", 250*time.Millisecond, "Initial jittered backoff between Kroki retries, doubled per retry")
+	fs.DurationVar(&cfg.KrokiRetryMaxBackoff, "kroki-retry-max-backoff", 5*time.Second, "Maximum backoff between Kroki retries, also capping Retry-After")
+	fs.IntVar(&cfg.KrokiBreakerThreshold, "kroki-breaker-threshold", 5, "Consecutive Kroki failures that open the circuit breaker (0 disables)")
+	fs.DurationVar(&cfg.KrokiBreakerTimeout, "kroki-breaker-timeout", 30*time.Second, "How long the circuit breaker stays open before probing Kroki again")
+	fs.BoolVar(&cfg.KrokiInsecureSkipVerify, "kroki-insecure-skip-verify", false, "Skip verification of the Kroki server's TLS certificate (development only)")
+	fs.IntVar(&cfg.CacheEntries, "cache-entries", 128, "Rendered diagrams kept in the in-memory LRU cache (0 disables)")
+	fs.StringVar(&cfg.CacheDir, "cache-dir", "", "Directory for an on-disk render cache tier (default: disabled)")
+	fs.Int64Var(&cfg.CacheDirMaxBytes, "cache-dir-max-bytes", 256<<20, "Size limit of the on-disk render cache, evicting the least recently used entries (0 disables)")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", 24*time.Hour, "Time after which unused on-disk render cache entries expire (0 keeps them until evicted)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 15*time.Second, "In sse and http modes, how long in-flight renders may finish on SIGINT/SIGTERM before they are cancelled")
+	fs.DurationVar(&cfg.ReadinessTimeout, "readiness-timeout", 2*time.Second, "How long /readyz waits for the Kroki backends' /health endpoints")
+	fs.DurationVar(&cfg.DiscoveryInterval, "discovery-interval", 10*time.Minute, "How often to discover the diagram types the Kroki backends render from their /health endpoints (0 disables discovery)")
+	fs.DurationVar(&cfg.SessionIdleTimeout, "session-idle-timeout", 30*time.Minute, "In http mode, drop sessions idle for longer than this (0 keeps them until the client ends them)")
+
+	fs.StringVar(&cfg.AuthTokenFile, "auth-token-file", "", "File of accepted static bearer tokens, one per line (also read from KROKI_MCP_AUTH_TOKENS, comma-separated)")
+	fs.StringVar(&cfg.AuthJWKS, "auth-jwks", "", "JWKS URL or file of the OAuth authorization server; enables OAuth 2.1 access token validation")
+	fs.StringVar(&cfg.AuthIssuer, "auth-issuer", "", "Required iss claim of OAuth access tokens")
+	fs.StringVar(&cfg.AuthResource, "auth-resource", "", "Canonical URL of this MCP server, e.g. https://mcp.example.com/mcp, advertised in the protected-resource metadata")
+	fs.StringVar(&cfg.AuthAudience, "auth-audience", "", "Required aud claim of OAuth access tokens (default: --auth-resource)")
+	fs.StringArrayVar(&cfg.AuthAuthorizationServers, "auth-authorization-server", nil, "Authorization server advertised in the protected-resource metadata (default: --auth-issuer; repeatable)")
+	fs.StringSliceVar(&cfg.AuthScopes, "auth-scopes", nil, "Scopes OAuth access tokens must all grant")
+
+	fs.StringVar(&cfg.TraceExporter, "trace-exporter", "none", "OpenTelemetry span exporter: none, otlp (OTLP over HTTP) or stdout (written to stderr)")
+	fs.StringVar(&cfg.TraceEndpoint, "trace-endpoint", "", "OTLP/HTTP endpoint URL, e.g. http://localhost:4318 (default: OTEL_EXPORTER_OTLP_ENDPOINT, else http://localhost:4318)")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", 1, "Fraction of new traces sampled; traces propagated by the client follow its decision")
+
+	// Static tokens are secrets: they are accepted from the environment
+	// (KROKI_MCP_AUTH_TOKENS) or the config file, where the process list
+	// does not show them, and never printed.
+	fs.StringSliceVar(&cfg.AuthTokens, "auth-tokens", nil, "Accepted static bearer tokens")
+	fs.MarkHidden("auth-tokens")
+	config.MarkSecret(fs, "auth-tokens")
+
+	fs.String(config.FileFlag, "", "Configuration file (.yaml, .yml, .json or .toml) keyed by flag name; KROKI_MCP_* environment variables and flags override it")
+	fs.Bool(config.PrintFlag, false, "Print the effective configuration as YAML, secrets redacted, and exit")
+	return fs
+}
+
+// loadConfig parses args and fills in the rest of the configuration from
+// the environment and the configuration file (see config.Load). Invalid
+// arguments exit the process, as usual for flags.
+func loadConfig(args []string) (*config.Config, *pflag.FlagSet, error) {
+	cfg := &config.Config{}
+	fs := newFlagSet(cfg)
+	fs.Parse(args)
+	if err := config.Load(fs, os.LookupEnv); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs, nil
+}
+
+// validateConfig checks the settings that are not validated when they are
+// used, normalizing the case of the enumerated ones and resolving diagram
+// type aliases.
+func validateConfig(cfg *config.Config) error {
+	if !slices.Contains(serverModes, cfg.ServerMode) {
+		return fmt.Errorf("invalid --mode %q (supported: %s)", cfg.ServerMode, strings.Join(serverModes, ", "))
+	}
+	cfg.OutputFormat = strings.ToLower(cfg.OutputFormat)
+	if cfg.OutputFormat != "" && !slices.Contains(model.SupportedOutputFormats, cfg.OutputFormat) {
+		return fmt.Errorf("invalid --format %q (supported: %s)", cfg.OutputFormat, strings.Join(model.SupportedOutputFormats, ", "))
+	}
+	cfg.SVGSanitize = strings.ToLower(cfg.SVGSanitize)
+	if names := svgconv.SanitizePolicyNames(); !slices.Contains(names, cfg.SVGSanitize) {
+		return fmt.Errorf("invalid --svg-sanitize %q (supported: %s)", cfg.SVGSanitize, strings.Join(names, ", "))
+	}
+	diagramTypes := make([]string, 0, len(cfg.DiagramTypes))
+	for _, diagramType := range cfg.DiagramTypes {
+		diagram, ok := model.Diagrams.Lookup(diagramType)
+		if !ok {
+			return fmt.Errorf("invalid --diagram-types entry %q (supported: %s)", diagramType, strings.Join(model.Diagrams.Names(), ", "))
+		}
+		if !slices.Contains(diagramTypes, diagram.Name) {
+			diagramTypes = append(diagramTypes, diagram.Name)
+		}
+	}
+	cfg.DiagramTypes = diagramTypes
+	if !slices.Contains(telemetry.Exporters, cfg.TraceExporter) {
+		return fmt.Errorf("invalid --trace-exporter %q (supported: %s)", cfg.TraceExporter, strings.Join(telemetry.Exporters, ", "))
+	}
+	if cfg.TraceSampleRatio < 0 || cfg.TraceSampleRatio > 1 {
+		return fmt.Errorf("invalid --trace-sample-ratio %v (must be between 0 and 1)", cfg.TraceSampleRatio)
+	}
+	return nil
+}
+
+// newKrokiClient builds the Kroki client described by the kroki-* settings,
+// reporting its requests to m.
+func newKrokiClient(cfg *config.Config, m *metrics.Metrics) (*kroki.KrokiClient, error) {
+	backends := make([]kroki.Backend, 0, len(cfg.KrokiBackends))
+	for _, spec := range cfg.KrokiBackends {
+		backend, err := kroki.ParseBackend(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --kroki-backend: %w", err)
+		}
+		// Requests are routed by canonical name, so aliases such as dot
+		// must be resolved for the backend to ever match.
+		diagramTypes := make([]string, 0, len(backend.DiagramTypes))
+		for _, diagramType := range backend.DiagramTypes {
+			diagram, ok := model.Diagrams.Lookup(diagramType)
+			if !ok {
+				return nil, fmt.Errorf("invalid --kroki-backend %q: unknown diagram type %q (supported: %s)", spec, diagramType, strings.Join(model.Diagrams.Names(), ", "))
+			}
+			if !slices.Contains(diagramTypes, diagram.Name) {
+				diagramTypes = append(diagramTypes, diagram.Name)
+			}
+		}
+		backend.DiagramTypes = diagramTypes
+		backends = append(backends, backend)
+	}
+	return kroki.NewKrokiClient(cfg.KrokiHost,
+		kroki.WithBackends(backends...),
+		kroki.WithTimeout(cfg.KrokiTimeout),
+		kroki.WithDialTimeout(cfg.KrokiDialTimeout),
+		kroki.WithIdleConnTimeout(cfg.KrokiIdleConnTimeout),
+		kroki.WithProxy(cfg.KrokiProxy),
+		kroki.WithCAFile(cfg.KrokiCACert),
+		kroki.WithClientCertificate(cfg.KrokiClientCert, cfg.KrokiClientKey),
+		kroki.WithInsecureSkipVerify(cfg.KrokiInsecureSkipVerify),
+		kroki.WithRetry(kroki.RetryPolicy{
+			MaxAttempts:    cfg.KrokiMaxAttempts,
+			InitialBackoff: cfg.KrokiRetryBackoff,
+			MaxBackoff:     cfg.KrokiRetryMaxBackoff,
+		}),
+		kroki.WithCircuitBreaker(kroki.CircuitBreakerSettings{
+			FailureThreshold: cfg.KrokiBreakerThreshold,
+			OpenTimeout:      cfg.KrokiBreakerTimeout,
+		}),
+		kroki.WithRequestObserver(m.KrokiRequest),
+	)
+}
+
+// version is the release version, set at link time with
+// -ldflags "-X main.version=v1.2.3".
+var version string
+
+// serverModes are the values accepted by --mode.
+var serverModes = []string{"stdio", "sse", "http"}
+
+// transport is an MCP network transport mounted on our own http.Server at
+// pattern. shutdown ends its open sessions, which http.Server.Shutdown alone
+// would wait on forever since SSE streams never go idle.
+type transport struct {
+	http.Handler
+	pattern  string
+	shutdown func(ctx context.Context) error
+}
+
+// newTransport returns the legacy SSE transport for mode "sse" and the
+// Streamable HTTP transport, served at /mcp, for mode "http". The SSE server
+// routes its own /sse and /message paths, so it takes every path; the
+// Streamable HTTP server answers on any path it is given, so it gets /mcp
+// only.
+func newTransport(mode string, mcpServer *server.MCPServer, cfg *config.Config) transport {
+	if mode == "sse" {
+		sseServer := server.NewSSEServer(mcpServer)
+		return transport{Handler: sseServer, pattern: "/", shutdown: func(context.Context) error {
+			sseServer.CloseSessions()
+			return nil
+		}}
+	}
+	httpServer := server.NewStreamableHTTPServer(mcpServer,
+		server.WithStateful(true),
+		server.WithSessionIdleTTL(cfg.SessionIdleTimeout),
+	)
+	return transport{Handler: httpServer, pattern: "/mcp", shutdown: httpServer.Shutdown}
+}
+
+// serveHTTP runs the network modes until SIGINT or SIGTERM, then aborts
+// in-flight renders, closes the MCP sessions and stops the HTTP server.
+// Next to the MCP endpoints it serves the /healthz and /readyz probes,
+// which stay unauthenticated for load balancers, /version and the
+// Prometheus /metrics.
+func serveHTTP(logger *slog.Logger, cfg *config.Config, krokiServer *mcp.KrokiMCPServer, m *metrics.Metrics) {
+	logger.Info("Starting MCP server", "mode", cfg.ServerMode)
+	t := newTransport(cfg.ServerMode, krokiServer.Handler(), cfg)
+	mux := http.NewServeMux()
+	protect, err := authMiddleware(cfg, mux)
+	if err != nil {
+		logger.Error("Failed to configure authentication", "error", err)
+		os.Exit(1)
+	}
+	mux.Handle(t.pattern, protect(t))
+	mux.Handle("GET /healthz", health.Liveness())
+	// The probes follow the Kroki client a configuration reload swaps in.
+	mux.Handle("GET /readyz", health.Readiness(currentClient{krokiServer}, cfg.ReadinessTimeout))
+	mux.Handle("GET /version", protect(health.Version(health.NewVersionInfo(version), func() []kroki.Backend {
+		return krokiServer.KrokiClient().Backends()
+	}, krokiServer.EngineVersions)))
+	mux.Handle("GET /metrics", protect(m.Handler()))
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.ServerHost, cfg.ServerPort),
+		Handler: mux,
+	}
+
+	// On SIGINT/SIGTERM, stop accepting connections and tool calls, give
+	// in-flight renders the drain period to finish, then cancel the rest and
+	// close the MCP sessions; ListenAndServe returns http.ErrServerClosed as
+	// soon as the listener is closed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		stop() // a second signal kills the process without waiting
+		logger.Info("Shutting down MCP server", "mode", cfg.ServerMode, "drain", cfg.ShutdownTimeout)
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		serverDone := make(chan error, 1)
+		go func() { serverDone <- httpServer.Shutdown(drainCtx) }()
+		if err := krokiServer.Drain(drainCtx); err != nil {
+			logger.Warn("Drain period expired, cancelling in-flight renders", "error", err)
+		}
+		krokiServer.Close()
+		// SSE and Streamable HTTP listening streams never go idle, so the
+		// HTTP server shutdown only completes once their sessions end.
+		if err := t.shutdown(context.Background()); err != nil {
+			logger.Error("MCP session shutdown error", "error", err)
+		}
+		if err := <-serverDone; err != nil {
+			logger.Warn("Closing connections still open after the drain period", "error", err)
+			httpServer.Close()
+		}
+		logger.Info("MCP server stopped")
+	}()
+
+	logger.Info("MCP server listening", "mode", cfg.ServerMode, "host", cfg.ServerHost, "port", cfg.ServerPort)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Failed to start MCP server", "mode", cfg.ServerMode, "error", err)
+		os.Exit(1)
+	}
+	<-shutdownDone
+}
+
+// authMiddleware returns the configured bearer-token authentication and, in
+// OAuth mode, serves the protected-resource metadata (RFC 9728) on mux.
+// Without authentication configured it returns handlers unchanged.
+func authMiddleware(cfg *config.Config, mux *http.ServeMux) (func(http.Handler) http.Handler, error) {
+	var verifiers []auth.Verifier
+	tokens := cfg.AuthTokens
+	if cfg.AuthTokenFile != "" {
+		fileTokens, err := auth.LoadTokenFile(cfg.AuthTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+	if len(tokens) > 0 {
+		verifiers = append(verifiers, auth.NewStaticTokens(tokens...))
+	}
+
+	var metadataURL string
+	if cfg.AuthJWKS != "" {
+		resource, err := url.Parse(cfg.AuthResource)
+		if err != nil || !resource.IsAbs() || resource.Host == "" {
+			return nil, fmt.Errorf("--auth-resource must be the absolute URL of this server when --auth-jwks is set")
+		}
+		audience := cfg.AuthAudience
+		if audience == "" {
+			audience = cfg.AuthResource
+		}
+		keys, err := auth.NewJWKS(context.Background(), cfg.AuthJWKS)
+		if err != nil {
+			return nil, err
 		}
+		jwtVerifier, err := auth.NewJWTVerifier(auth.JWTConfig{
+			Keys:     keys,
+			Issuer:   cfg.AuthIssuer,
+			Audience: audience,
+			Scopes:   cfg.AuthScopes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, jwtVerifier)
+
+		authorizationServers := cfg.AuthAuthorizationServers
+		if len(authorizationServers) == 0 {
+			authorizationServers = []string{cfg.AuthIssuer}
+		}
+		metadata := server.NewProtectedResourceMetadataHandler(server.ProtectedResourceMetadataConfig{
+			Resource:               cfg.AuthResource,
+			AuthorizationServers:   authorizationServers,
+			ScopesSupported:        cfg.AuthScopes,
+			BearerMethodsSupported: []string{"header"},
+			ResourceName:           "Kroki MCP Server",
+		})
+		// RFC 9728 puts the metadata of a path-qualified resource under the
+		// path-suffixed well-known URL; the bare one is served as well for
+		// clients that only try that.
+		metadataPath := server.ProtectedResourceMetadataPath(cfg.AuthResource)
+		mux.Handle(metadataPath, metadata)
+		if metadataPath != server.WellKnownProtectedResourcePath {
+			mux.Handle(server.WellKnownProtectedResourcePath, metadata)
+		}
+		metadataURL = (&url.URL{Scheme: resource.Scheme, Host: resource.Host, Path: metadataPath}).String()
+	}
 
-		os.Exit(0)
+	if len(verifiers) == 0 {
+		return func(h http.Handler) http.Handler { return h }, nil
 	}
+	return auth.Middleware(auth.Any(verifiers...), metadataURL, cfg.AuthScopes), nil
 }
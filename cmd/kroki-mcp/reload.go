@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	"github.com/utain/kroki-mcp/internal/config"
+	"github.com/utain/kroki-mcp/internal/kroki"
+	"github.com/utain/kroki-mcp/internal/mcp"
+	"github.com/utain/kroki-mcp/internal/metrics"
+)
+
+// reloadable reports whether a changed setting takes effect on a reload;
+// the others, such as the listen address or authentication, need a restart.
+func reloadable(flag string) bool {
+	switch flag {
+	case "log-level", "format", "diagram-types", "svg-sanitize":
+		return true
+	}
+	return strings.HasPrefix(flag, "kroki-")
+}
+
+// reloader re-reads the configuration on SIGHUP and when the configuration
+// file changes, and applies the reloadable settings to the running server.
+type reloader struct {
+	logger  *slog.Logger
+	args    []string
+	server  *mcp.KrokiMCPServer
+	metrics *metrics.Metrics
+
+	mu sync.Mutex
+	fs *pflag.FlagSet // the flags the current configuration was loaded into
+}
+
+func newReloader(logger *slog.Logger, args []string, fs *pflag.FlagSet, server *mcp.KrokiMCPServer, m *metrics.Metrics) *reloader {
+	return &reloader{logger: logger, args: args, server: server, metrics: m, fs: fs}
+}
+
+// watch reloads the configuration on SIGHUP and, when there is a
+// configuration file, whenever it changes, until ctx ends.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				r.logger.Info("Received SIGHUP, reloading configuration")
+				r.reload()
+			}
+		}
+	}()
+
+	path := config.FilePath(r.fs, os.LookupEnv)
+	if path == "" {
+		return
+	}
+	if err := config.Watch(ctx, path, func() {
+		r.logger.Info("Configuration file changed, reloading configuration", "path", path)
+		r.reload()
+	}); err != nil {
+		r.logger.Warn("Not watching the configuration file; send SIGHUP to reload it", "path", path, "error", err)
+	}
+}
+
+// reload loads the configuration again from the same arguments, the
+// environment and the file. An invalid configuration is logged and the
+// current one kept. Otherwise a new Kroki client replaces the current one
+// when a kroki-* setting changed, the log level is updated, and the tools
+// are re-registered when their definitions changed.
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, fs, err := loadConfig(r.args)
+	if err == nil {
+		err = validateConfig(cfg)
+	}
+	if err != nil {
+		r.logger.Error("Failed to reload configuration, keeping the current one", "error", err)
+		return
+	}
+
+	var changed, restart []string
+	r.fs.VisitAll(func(f *pflag.Flag) {
+		if f.Name == config.FileFlag || f.Name == config.PrintFlag {
+			return
+		}
+		if next := fs.Lookup(f.Name); next != nil && next.Value.String() != f.Value.String() {
+			if reloadable(f.Name) {
+				changed = append(changed, f.Name)
+			} else {
+				restart = append(restart, f.Name)
+			}
+		}
+	})
+
+	var kc *kroki.KrokiClient
+	if slices.ContainsFunc(changed, func(name string) bool { return strings.HasPrefix(name, "kroki-") }) {
+		if kc, err = newKrokiClient(cfg, r.metrics); err != nil {
+			r.logger.Error("Failed to reload configuration, keeping the current one", "error", err)
+			return
+		}
+	}
+	// The settings that need a restart are only read at startup, so they are
+	// reported once, when they change.
+	if len(restart) > 0 {
+		r.logger.Warn("Changed settings take effect only after a restart", "settings", restart)
+	}
+	r.fs = fs
+	if len(changed) == 0 {
+		r.logger.Info("Configuration reloaded, nothing to apply")
+		return
+	}
+
+	if kc != nil {
+		previous := r.server.KrokiClient()
+		r.server.SetKrokiClient(kc)
+		previous.CloseIdleConnections()
+		// The new backends may render other types than the previous ones.
+		if cfg.DiscoveryInterval > 0 {
+			go func() {
+				if err := r.server.DiscoverDiagramTypes(context.Background()); err != nil {
+					r.logger.Warn("Diagram type discovery failed, keeping the current types", "error", err)
+				}
+			}()
+		}
+	}
+	config.SetLogLevel(cfg.LogLevel)
+	toolsChanged := r.server.UpdateConfig(cfg)
+
+	r.logger.Info("Configuration reloaded", "changed", changed, "toolsChanged", toolsChanged)
+}
+
+// currentClient checks the health of the Kroki client the server currently
+// uses, which a reload may swap.
+type currentClient struct {
+	server *mcp.KrokiMCPServer
+}
+
+func (c currentClient) CheckHealth(ctx context.Context) []kroki.BackendHealth {
+	return c.server.KrokiClient().CheckHealth(ctx)
+}
@@ -0,0 +1,111 @@
+// Package auth authenticates requests to the network MCP transports with
+// bearer tokens: static shared secrets, or OAuth 2.1 access tokens (JWTs)
+// validated against an authorization server's JWKS.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrInvalidToken is returned for a missing, malformed, expired or
+	// unknown bearer token.
+	ErrInvalidToken = errors.New("invalid bearer token")
+	// ErrInsufficientScope is returned for a valid token lacking a scope the
+	// server requires.
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// Verifier checks a bearer token, returning an error wrapping
+// ErrInvalidToken or ErrInsufficientScope when it is not accepted.
+type Verifier interface {
+	Verify(ctx context.Context, token string) error
+}
+
+// Any accepts a token when one of verifiers does, so static tokens and
+// OAuth access tokens can be enabled together. When all of them reject it,
+// the most specific error wins: a valid token lacking a scope is reported
+// as such rather than as invalid.
+func Any(verifiers ...Verifier) Verifier {
+	return anyVerifier(verifiers)
+}
+
+type anyVerifier []Verifier
+
+func (a anyVerifier) Verify(ctx context.Context, token string) error {
+	err := ErrInvalidToken
+	for _, v := range a {
+		verr := v.Verify(ctx, token)
+		if verr == nil {
+			return nil
+		}
+		if errors.Is(verr, ErrInsufficientScope) || !errors.Is(err, ErrInsufficientScope) {
+			err = verr
+		}
+	}
+	return err
+}
+
+// Middleware rejects requests to next that lack a bearer token accepted by
+// v, answering 401 (or 403 for an insufficient scope) with the
+// WWW-Authenticate challenge of RFC 6750. A non-empty metadataURL is
+// advertised in the challenge as resource_metadata, which is how MCP
+// clients discover the authorization server (RFC 9728).
+func Middleware(v Verifier, metadataURL string, scopes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				challenge(w, metadataURL, "", scopes)
+				return
+			}
+			if err := v.Verify(r.Context(), token); err != nil {
+				slog.Warn("Rejected MCP request", "remote", r.RemoteAddr, "path", r.URL.Path, "error", err)
+				if errors.Is(err, ErrInsufficientScope) {
+					challenge(w, metadataURL, "insufficient_scope", scopes)
+				} else {
+					challenge(w, metadataURL, "invalid_token", scopes)
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// challenge writes the RFC 6750 §3 error response. A request without
+// credentials gets a challenge without an error code.
+func challenge(w http.ResponseWriter, metadataURL, code string, scopes []string) {
+	params := []string{`realm="kroki-mcp"`}
+	if metadataURL != "" {
+		params = append(params, fmt.Sprintf("resource_metadata=%q", metadataURL))
+	}
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+	if code == "insufficient_scope" && len(scopes) > 0 {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(scopes, " ")))
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+
+	status := http.StatusUnauthorized
+	if code == "insufficient_scope" {
+		status = http.StatusForbidden
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// verifierFunc adapts a function to Verifier.
+type verifierFunc func(token string) error
+
+func (f verifierFunc) Verify(_ context.Context, token string) error { return f(token) }
+
+func TestMiddleware(t *testing.T) {
+	v := verifierFunc(func(token string) error {
+		switch token {
+		case "good":
+			return nil
+		case "narrow":
+			return ErrInsufficientScope
+		default:
+			return ErrInvalidToken
+		}
+	})
+	h := Middleware(v, "https://mcp.example.com/.well-known/oauth-protected-resource/mcp", []string{"diagrams"})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantChallenge string
+	}{
+		{name: "accepted", authorization: "Bearer good", wantStatus: http.StatusTeapot},
+		{name: "case-insensitive scheme", authorization: "bearer good", wantStatus: http.StatusTeapot},
+		{
+			name:          "missing",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="kroki-mcp", resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp"`,
+		},
+		{
+			name:          "basic auth",
+			authorization: "Basic Zm9vOmJhcg==",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="kroki-mcp", resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp"`,
+		},
+		{
+			name:          "invalid",
+			authorization: "Bearer bad",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="kroki-mcp", resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp", error="invalid_token"`,
+		},
+		{
+			name:          "insufficient scope",
+			authorization: "Bearer narrow",
+			wantStatus:    http.StatusForbidden,
+			wantChallenge: `Bearer realm="kroki-mcp", resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp", error="insufficient_scope", scope="diagrams"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestAny(t *testing.T) {
+	static := NewStaticTokens("secret")
+	narrow := verifierFunc(func(token string) error {
+		if token == "jwt" {
+			return ErrInsufficientScope
+		}
+		return ErrInvalidToken
+	})
+	v := Any(narrow, static)
+
+	if err := v.Verify(context.Background(), "secret"); err != nil {
+		t.Errorf("static token rejected: %v", err)
+	}
+	if err := v.Verify(context.Background(), "jwt"); !errors.Is(err, ErrInsufficientScope) {
+		t.Errorf("err = %v, want ErrInsufficientScope", err)
+	}
+	if err := v.Verify(context.Background(), "other"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksMaxAge is how long fetched keys are used before the set is
+	// reloaded, so keys the authorization server retired stop validating.
+	jwksMaxAge = time.Hour
+	// jwksMinRefresh is the least time between two loads: it rate-limits
+	// reloads triggered by tokens signed with an unknown key ID and backs
+	// off after a failed load.
+	jwksMinRefresh = time.Minute
+)
+
+// JWKS is the public key set of an authorization server, loaded from an
+// http(s) URL or a local file and reloaded when it ages out or a token
+// names a key it does not contain.
+type JWKS struct {
+	location   string
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	lastAttempt time.Time // of a load, successful or not
+	// reloading is closed when the reload in progress ends; nil when none
+	// is.
+	reloading chan struct{}
+}
+
+// NewJWKS loads the key set at location, an http(s) URL or a file path,
+// failing when it cannot be read or holds no usable signing key.
+func NewJWKS(ctx context.Context, location string) (*JWKS, error) {
+	ks := &JWKS{
+		location:   location,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+	}
+	keys, err := ks.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys, ks.loadedAt = keys, ks.now()
+	ks.lastAttempt = ks.loadedAt
+	return ks, nil
+}
+
+// key returns the public key with kid, or the only key of the set when the
+// token names none. Keys older than jwksMaxAge are still used while the set
+// reloads in the background; only a kid the set lacks waits for a reload.
+func (ks *JWKS) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.reload(ctx, jwksMaxAge)
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	if done := ks.reload(ctx, jwksMinRefresh); done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if key, ok := ks.lookup(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no JWKS key with kid %q", kid)
+}
+
+// reload starts reloading the key set when it is older than maxAge and no
+// load was attempted in the last jwksMinRefresh, and returns a channel
+// closed when the reload in progress ends, or nil when there is none.
+// Requests finding the set stale at the same time share one load, which runs
+// without holding ks.mu; a failed load keeps the previous keys.
+func (ks *JWKS) reload(ctx context.Context, maxAge time.Duration) <-chan struct{} {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.reloading != nil {
+		return ks.reloading
+	}
+	now := ks.now()
+	if now.Sub(ks.loadedAt) <= maxAge || now.Sub(ks.lastAttempt) <= jwksMinRefresh {
+		return nil
+	}
+	done := make(chan struct{})
+	ks.reloading, ks.lastAttempt = done, now
+
+	// The load serves every waiting request, so it must not end with the
+	// one that started it; the HTTP client's timeout bounds it.
+	go func() {
+		keys, err := ks.load(context.WithoutCancel(ctx))
+		ks.mu.Lock()
+		if err != nil {
+			slog.Warn("Failed to reload JWKS, keeping the previous keys", "location", ks.location, "error", err)
+		} else {
+			ks.keys, ks.loadedAt = keys, ks.now()
+		}
+		ks.reloading = nil
+		ks.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (ks *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// load reads and parses the key set at ks.location.
+func (ks *JWKS) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := ks.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS %s: %w", ks.location, err)
+	}
+	slog.Debug("Loaded JWKS", "location", ks.location, "keys", len(keys))
+	return keys, nil
+}
+
+func (ks *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(ks.location, "http://") && !strings.HasPrefix(ks.location, "https://") {
+		data, err := os.ReadFile(ks.location)
+		if err != nil {
+			return nil, fmt.Errorf("read JWKS: %w", err)
+		}
+		return data, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := ks.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS %s: %s", ks.location, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// jwk holds the RFC 7517/7518/8037 members of the key types we verify
+// signatures with.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the signing keys of a JWK Set by key ID. Encryption
+// keys and key types other than RSA, EC and Ed25519 are skipped. Key IDs
+// must be unique, and a set of several keys must name each, since a key
+// without one is only used when it is the set's only key.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		if _, dup := keys[k.Kid]; dup {
+			return nil, fmt.Errorf("duplicate kid %q", k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA, EC or Ed25519 signing keys")
+	}
+	if _, unnamed := keys[""]; unnamed && len(keys) > 1 {
+		return nil, fmt.Errorf("signing key without a kid in a set of %d keys", len(keys))
+	}
+	return keys, nil
+}
+
+// publicKey decodes k, returning nil for an unsupported key type.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("e out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtLeeway tolerates clock skew between us and the authorization server
+// when checking exp, nbf and iat.
+const jwtLeeway = 30 * time.Second
+
+// JWTConfig describes the access tokens an OAuth 2.1 resource server
+// accepts.
+type JWTConfig struct {
+	// Keys verifies token signatures.
+	Keys *JWKS
+	// Issuer must match the iss claim.
+	Issuer string
+	// Audience must be among the aud claim; it is normally this server's
+	// resource identifier.
+	Audience string
+	// Scopes must all be granted by the scope (or scp) claim.
+	Scopes []string
+}
+
+// JWTVerifier accepts signed, unexpired JWT access tokens issued for this
+// server.
+type JWTVerifier struct {
+	cfg    JWTConfig
+	parser *jwt.Parser
+}
+
+// NewJWTVerifier returns a verifier for cfg. Issuer and Audience are
+// required: without them a token minted for any other resource by the same
+// authorization server would be accepted.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if cfg.Keys == nil {
+		return nil, fmt.Errorf("JWT verification needs a JWKS")
+	}
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, fmt.Errorf("JWT verification needs an issuer and an audience")
+	}
+	return &JWTVerifier{
+		cfg: cfg,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(jwtLeeway),
+		),
+	}, nil
+}
+
+// accessClaims are the registered claims plus the OAuth scope claims: the
+// space-separated scope of RFC 9068, or the scp array some servers use.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, token string) error {
+	var claims accessClaims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.cfg.Keys.key(ctx, kid)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	granted := append(strings.Fields(claims.Scope), claims.Scp...)
+	for _, scope := range v.cfg.Scopes {
+		if !slices.Contains(granted, scope) {
+			return fmt.Errorf("%w: token lacks scope %q", ErrInsufficientScope, scope)
+		}
+	}
+	return nil
+}
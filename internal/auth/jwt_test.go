@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "https://mcp.example.com/mcp"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// writeJWKS writes a JWK Set with the public halves of rsaKey (kid "rsa")
+// and ecKey (kid "ec") to a file and returns its path.
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewJWKS(context.Background(), writeJWKS(t, rsaKey, ecKey))
+	if err != nil {
+		t.Fatalf("NewJWKS: %v", err)
+	}
+	v, err := NewJWTVerifier(JWTConfig{Keys: keys, Issuer: testIssuer, Audience: testAudience, Scopes: []string{"diagrams"}})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	now := time.Now()
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   testIssuer,
+			"aud":   []string{testAudience},
+			"sub":   "agent",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"scope": "openid diagrams",
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil))},
+		{name: "ES256", token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil))},
+		{name: "scp array", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"scope": nil, "scp": []string{"diagrams"}}))},
+		{name: "expired", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})), wantErr: ErrInvalidToken},
+		{name: "no expiry", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": nil})), wantErr: ErrInvalidToken},
+		{name: "wrong issuer", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"iss": "https://evil.example.com"})), wantErr: ErrInvalidToken},
+		{name: "wrong audience", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": "https://other.example.com"})), wantErr: ErrInvalidToken},
+		{name: "forged signature", token: sign(t, jwt.SigningMethodRS256, "rsa", otherKey, claims(nil)), wantErr: ErrInvalidToken},
+		{name: "encryption key", token: sign(t, jwt.SigningMethodRS256, "enc", rsaKey, claims(nil)), wantErr: ErrInvalidToken},
+		{name: "HMAC with public key", token: sign(t, jwt.SigningMethodHS256, "rsa", rsaKey.N.Bytes(), claims(nil)), wantErr: ErrInvalidToken},
+		{name: "missing scope", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"scope": "openid"})), wantErr: ErrInsufficientScope},
+		{name: "not a JWT", token: "opaque-token", wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Rotating the authorization server's keys must not need a restart: a token
+// signed with an unknown kid reloads the set, at most once per
+// jwksMinRefresh.
+func TestJWKS_ReloadsOnUnknownKeyID(t *testing.T) {
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := atomic.Pointer[rsa.PrivateKey]{}
+	current.Store(first)
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		key := current.Load()
+		kid := "first"
+		if key == second {
+			kid = "second"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": kid, "n": b64(key.N.Bytes()), "e": "AQAB"},
+		}})
+	}))
+	t.Cleanup(ts.Close)
+
+	keys, err := NewJWKS(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("NewJWKS: %v", err)
+	}
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	current.Store(second)
+	if _, err := keys.key(context.Background(), "second"); err == nil {
+		t.Fatal("unknown kid resolved before jwksMinRefresh elapsed")
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d, want 1 (reload is rate-limited)", got)
+	}
+
+	now = now.Add(jwksMinRefresh + time.Second)
+	if _, err := keys.key(context.Background(), "second"); err != nil {
+		t.Fatalf("rotated key not found after reload: %v", err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+}
+
+func TestJWKS_ReloadIsSingleFlighted(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "k", "n": b64(key.N.Bytes()), "e": "AQAB"},
+		}})
+	}))
+	t.Cleanup(ts.Close)
+
+	keys, err := NewJWKS(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("NewJWKS: %v", err)
+	}
+	stale := time.Now().Add(jwksMaxAge + time.Minute)
+	keys.now = func() time.Time { return stale }
+
+	// The requests share one reload, and the previous keys stay readable while
+	// it hangs.
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() {
+			_, err := keys.key(context.Background(), "k")
+			errs <- err
+		}()
+	}
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := keys.lookup("k"); !ok {
+		t.Error("previous keys unavailable during the reload")
+	}
+	close(release)
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			t.Errorf("key: %v", err)
+		}
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2 (one shared reload)", got)
+	}
+}
+
+func TestJWKS_BacksOffAfterFailedReload(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "k", "n": b64(key.N.Bytes()), "e": "AQAB"},
+		}})
+	}))
+	t.Cleanup(ts.Close)
+
+	keys, err := NewJWKS(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("NewJWKS: %v", err)
+	}
+	now := time.Now().Add(jwksMaxAge + time.Minute)
+	keys.now = func() time.Time { return now }
+
+	// The aged keys keep verifying while the reload fails.
+	if _, err := keys.key(context.Background(), "k"); err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	keys.mu.Lock()
+	done := keys.reloading
+	keys.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Fatalf("fetches = %d, want 2", got)
+	}
+
+	now = now.Add(jwksMinRefresh / 2)
+	if _, err := keys.key(context.Background(), "k"); err != nil {
+		t.Errorf("key after the failed reload: %v", err)
+	}
+	if _, err := keys.key(context.Background(), "unknown"); err == nil {
+		t.Error("unknown kid resolved")
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2 (no reload within jwksMinRefresh of a failure)", got)
+	}
+}
+
+func TestNewJWKS_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"not json":  "{",
+		"no keys":   `{"keys": []}`,
+		"only enc":  `{"keys": [{"kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		"bad curve": `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		"dup kid":   `{"keys": [{"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}, {"kty": "RSA", "kid": "a", "n": "AQAC", "e": "AQAB"}]}`,
+		"no kids":   `{"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQAB"}, {"kty": "RSA", "n": "AQAC", "e": "AQAB"}]}`,
+		"one kid":   `{"keys": [{"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}, {"kty": "RSA", "n": "AQAC", "e": "AQAB"}]}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewJWKS(context.Background(), path); err == nil {
+			t.Errorf("%s: NewJWKS accepted an unusable key set", name)
+		}
+	}
+	if _, err := NewJWKS(context.Background(), filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("NewJWKS accepted a missing file")
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StaticTokens accepts a fixed set of shared-secret bearer tokens.
+type StaticTokens struct {
+	// digests are compared instead of the tokens so the comparison is
+	// constant-time regardless of token length.
+	digests [][sha256.Size]byte
+}
+
+// NewStaticTokens returns a verifier accepting tokens. Blank tokens are
+// ignored.
+func NewStaticTokens(tokens ...string) *StaticTokens {
+	st := &StaticTokens{}
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" {
+			st.digests = append(st.digests, sha256.Sum256([]byte(token)))
+		}
+	}
+	return st
+}
+
+// ParseTokens splits a comma- or newline-separated token list, as found in
+// a token file. Lines starting with # are comments.
+func ParseTokens(s string) []string {
+	var tokens []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, token := range strings.Split(line, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// LoadTokenFile reads the tokens in path, in the ParseTokens format.
+func LoadTokenFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+	tokens := ParseTokens(string(data))
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("token file %q contains no tokens", path)
+	}
+	return tokens, nil
+}
+
+// Len returns the number of accepted tokens.
+func (st *StaticTokens) Len() int {
+	return len(st.digests)
+}
+
+func (st *StaticTokens) Verify(_ context.Context, token string) error {
+	digest := sha256.Sum256([]byte(token))
+	match := 0
+	for _, d := range st.digests {
+		match |= subtle.ConstantTimeCompare(d[:], digest[:])
+	}
+	if match == 0 {
+		return fmt.Errorf("%w: unknown static token", ErrInvalidToken)
+	}
+	return nil
+}
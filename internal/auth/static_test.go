@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseTokens(t *testing.T) {
+	got := ParseTokens("# deploy tokens\nalpha\n beta , gamma\n\n#delta\n")
+	want := []string{"alpha", "beta", "gamma"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseTokens = %v, want %v", got, want)
+	}
+}
+
+func TestLoadTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens")
+	if err := os.WriteFile(path, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := LoadTokenFile(path)
+	if err != nil {
+		t.Fatalf("LoadTokenFile: %v", err)
+	}
+	st := NewStaticTokens(tokens...)
+	if st.Len() != 2 {
+		t.Errorf("Len = %d, want 2", st.Len())
+	}
+	if err := st.Verify(context.Background(), "beta"); err != nil {
+		t.Errorf("Verify(beta): %v", err)
+	}
+	if err := st.Verify(context.Background(), "bet"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(bet) = %v, want ErrInvalidToken", err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("# nothing yet\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTokenFile(empty); err == nil {
+		t.Error("LoadTokenFile accepted a file without tokens")
+	}
+}
@@ -0,0 +1,84 @@
+// Package cache stores rendered diagrams keyed by everything that determines
+// their bytes, so identical renders within a conversation skip Kroki.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Cache is a store of rendered outputs. Implementations are safe for
+// concurrent use; failures to read or write are treated as misses and logged
+// rather than surfaced, since the cache is only an optimization.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, value []byte)
+}
+
+// Key identifies a rendered output: two renders with equal keys produce the
+// same bytes.
+type Key struct {
+	DiagramType string            `json:"diagramType"`
+	Source      string            `json:"source"`
+	Format      string            `json:"format"`
+	Options     map[string]string `json:"options,omitempty"`
+	DPI         float64           `json:"dpi,omitempty"`
+	// PostProcess names the local transformation applied to Kroki's output,
+	// e.g. inline SVG normalization or rasterization.
+	PostProcess string `json:"postProcess,omitempty"`
+	// Background and Quality are the local conversion's background color
+	// and JPEG quality, and Theme the page theme the SVG was adapted to.
+	Background string `json:"background,omitempty"`
+	Quality    int    `json:"quality,omitempty"`
+	Theme      string `json:"theme,omitempty"`
+	// Backends identifies the Kroki servers the render may be sent to, so
+	// repointing the client at another server, possibly running other
+	// engine versions, does not serve the previous servers' renders.
+	Backends []string `json:"backends,omitempty"`
+}
+
+// String returns the content address of k: the hex SHA-256 of its canonical
+// JSON encoding, with the source normalized first so that line-ending and
+// trailing-newline differences share an entry.
+func (k Key) String() string {
+	k.Source = NormalizeSource(k.Source)
+	// Marshal cannot fail for this type; map keys are encoded sorted.
+	data, _ := json.Marshal(k)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeSource converts CRLF and CR line endings to LF and trims trailing
+// newlines, neither of which changes how Kroki renders a diagram. Other
+// whitespace is kept: indentation lays out ASCII-art types such as ditaa and
+// svgbob.
+func NormalizeSource(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	return strings.TrimRight(source, "\n")
+}
+
+// Tiered layers caches from fastest to slowest. Get consults them in order
+// and copies a hit into the faster tiers it missed; Put writes through to
+// every tier.
+type Tiered []Cache
+
+func (t Tiered) Get(key string) ([]byte, bool) {
+	for i, c := range t {
+		if value, ok := c.Get(key); ok {
+			for _, faster := range t[:i] {
+				faster.Put(key, value)
+			}
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (t Tiered) Put(key string, value []byte) {
+	for _, c := range t {
+		c.Put(key, value)
+	}
+}
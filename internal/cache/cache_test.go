@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKey_NormalizesSource(t *testing.T) {
+	a := Key{DiagramType: "plantuml", Source: "@startuml\r\nA -> B\r\n@enduml\r\n", Format: "svg"}
+	b := Key{DiagramType: "plantuml", Source: "@startuml\nA -> B\n@enduml", Format: "svg"}
+	if a.String() != b.String() {
+		t.Errorf("keys differing only in line endings and trailing newlines must match")
+	}
+
+	indented := Key{DiagramType: "ditaa", Source: "  +--+\n  |  |", Format: "svg"}
+	flush := Key{DiagramType: "ditaa", Source: "+--+\n  |  |", Format: "svg"}
+	if indented.String() == flush.String() {
+		t.Errorf("keys differing in indentation must not match: it lays out ASCII art")
+	}
+}
+
+func TestKey_DistinguishesRenderInputs(t *testing.T) {
+	base := Key{DiagramType: "graphviz", Source: "digraph { a -> b }", Format: "png"}
+	variants := []Key{
+		{DiagramType: "dot", Source: base.Source, Format: base.Format},
+		{DiagramType: base.DiagramType, Source: "digraph { b -> a }", Format: base.Format},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: "svg"},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: base.Format, Options: map[string]string{"layout": "neato"}},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: base.Format, DPI: 150},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: base.Format, PostProcess: "rasterize"},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: base.Format, Background: "white"},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: base.Format, Quality: 80},
+		{DiagramType: base.DiagramType, Source: base.Source, Format: base.Format, Theme: "dark"},
+	}
+	for _, v := range variants {
+		if v.String() == base.String() {
+			t.Errorf("key %+v collides with %+v", v, base)
+		}
+	}
+}
+
+func TestMemory_EvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemory(2)
+	m.Put("a", []byte("1"))
+	m.Put("b", []byte("2"))
+	if _, ok := m.Get("a"); !ok {
+		t.Fatal("expected a hit for a")
+	}
+	m.Put("c", []byte("3")) // evicts b, the least recently used
+
+	if _, ok := m.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("expected a hit for %s", key)
+		}
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len = %d, want 2", m.Len())
+	}
+}
+
+func TestDisk_RoundTripAndTTL(t *testing.T) {
+	d, err := NewDisk(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	d.Put("k", []byte("value"))
+	if got, ok := d.Get("k"); !ok || string(got) != "value" {
+		t.Fatalf("Get = %q, %v; want %q, true", got, ok, "value")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok := d.Get("k"); ok {
+		t.Error("expired entry was returned")
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "k")); !os.IsNotExist(err) {
+		t.Errorf("expired entry was not removed: %v", err)
+	}
+}
+
+func TestDisk_EvictsOldestOverSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDisk(dir, 10, 0)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+
+	d.Put("old", []byte("12345"))
+	past := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "old"), past, past); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	d.Put("mid", []byte("12345"))
+	d.Put("new", []byte("12345"))
+
+	if _, ok := d.Get("old"); ok {
+		t.Error("oldest entry survived the size limit")
+	}
+	for _, key := range []string{"mid", "new"} {
+		if _, ok := d.Get(key); !ok {
+			t.Errorf("expected a hit for %s", key)
+		}
+	}
+}
+
+func TestDisk_HitsRefreshRecency(t *testing.T) {
+	dir := t.TempDir()
+	// An entry left by a previous run counts toward the size limit.
+	if err := os.WriteFile(filepath.Join(dir, "kept"), []byte("12345"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDisk(dir, 10, 0)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+	d.Put("unused", []byte("12345"))
+	past := time.Now().Add(-time.Minute)
+	for _, key := range []string{"kept", "unused"} {
+		if err := os.Chtimes(filepath.Join(dir, key), past, past); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+	if _, ok := d.Get("kept"); !ok {
+		t.Fatal("expected a hit for kept")
+	}
+	d.Put("new", []byte("12345"))
+
+	if _, ok := d.Get("unused"); ok {
+		t.Error("least recently used entry survived the size limit")
+	}
+	for _, key := range []string{"kept", "new"} {
+		if _, ok := d.Get(key); !ok {
+			t.Errorf("expected a hit for %s", key)
+		}
+	}
+}
+
+func TestTiered_PromotesHits(t *testing.T) {
+	memory := NewMemory(4)
+	disk, err := NewDisk(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+	disk.Put("k", []byte("value"))
+
+	tiers := Tiered{memory, disk}
+	if got, ok := tiers.Get("k"); !ok || string(got) != "value" {
+		t.Fatalf("Get = %q, %v; want %q, true", got, ok, "value")
+	}
+	if _, ok := memory.Get("k"); !ok {
+		t.Error("disk hit was not promoted to the memory tier")
+	}
+}
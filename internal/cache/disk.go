@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Disk caches entries as files in a directory, one file per key. A hit
+// refreshes the entry's modification time, so entries unused for longer than
+// the TTL are treated as misses and removed, and once the directory grows
+// past maxBytes, the least recently used entries are evicted.
+type Disk struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	// mu guards size and sweptAt and serializes sweeps.
+	mu sync.Mutex
+	// size is the total size of the entries as of the last sweep, plus the
+	// entries written since, so writes only list the directory when it may
+	// be over maxBytes.
+	size    int64
+	sweptAt time.Time
+}
+
+// NewDisk returns a disk cache in dir, creating the directory if needed. A
+// maxBytes or ttl of zero disables the respective limit.
+func NewDisk(dir string, maxBytes int64, ttl time.Duration) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	d := &Disk{dir: dir, maxBytes: maxBytes, ttl: ttl, now: time.Now}
+	d.mu.Lock()
+	d.sweep()
+	d.mu.Unlock()
+	return d, nil
+}
+
+func (d *Disk) Get(key string) ([]byte, bool) {
+	path := d.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if d.expired(info) {
+		if os.Remove(path) == nil {
+			d.mu.Lock()
+			d.size -= info.Size()
+			d.mu.Unlock()
+		}
+		return nil, false
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		slog.Warn("Failed to read render cache entry", "path", path, "error", err)
+		return nil, false
+	}
+	now := d.now()
+	_ = os.Chtimes(path, now, now)
+	return value, true
+}
+
+func (d *Disk) Put(key string, value []byte) {
+	if d.maxBytes > 0 && int64(len(value)) > d.maxBytes {
+		return
+	}
+	var replaced int64
+	if info, err := os.Stat(d.path(key)); err == nil {
+		replaced = info.Size()
+	}
+	// Write to a temporary file and rename it into place, so concurrent
+	// readers never see a partially written entry.
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		slog.Warn("Failed to write render cache entry", "error", err)
+		return
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		slog.Warn("Failed to write render cache entry", "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.size += int64(len(value)) - replaced
+	if (d.maxBytes > 0 && d.size > d.maxBytes) || (d.ttl > 0 && d.now().Sub(d.sweptAt) > d.ttl) {
+		d.sweep()
+	}
+}
+
+// sweep removes expired entries and then the least recently used ones until
+// the directory fits in maxBytes, and recounts size. d.mu must be held.
+func (d *Disk) sweep() {
+	d.sweptAt = d.now()
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		slog.Warn("Failed to list render cache directory", "dir", d.dir, "error", err)
+		return
+	}
+	var (
+		files []fs.FileInfo
+		total int64
+	)
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name()[0] == '.' {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if d.expired(info) {
+			_ = os.Remove(filepath.Join(d.dir, e.Name()))
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	d.size = total
+	if d.maxBytes <= 0 || d.size <= d.maxBytes {
+		return
+	}
+	slices.SortFunc(files, func(a, b fs.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	for _, info := range files {
+		if d.size <= d.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(d.dir, info.Name())); err == nil {
+			d.size -= info.Size()
+		}
+	}
+}
+
+func (d *Disk) expired(info fs.FileInfo) bool {
+	return d.ttl > 0 && d.now().Sub(info.ModTime()) > d.ttl
+}
+
+// path returns the file for key. Keys are Key.String() hex digests, so they
+// are safe file names.
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.dir, filepath.Base(key))
+}
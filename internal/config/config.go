@@ -1,5 +1,10 @@
 package config
 
+import "time"
+
+// Config holds the settings of kroki-mcp. Each field is bound to a
+// command-line flag, which Load also fills in from the environment and the
+// configuration file.
 type Config struct {
 	ServerHost   string
 	ServerPort   int
@@ -8,4 +13,75 @@ type Config struct {
 	KrokiHost    string
 	LogLevel     string
 	LogFormat    string
+
+	// DiagramTypes restricts the diagram types the tools accept; empty
+	// allows every supported type.
+	DiagramTypes []string
+
+	// SVGSanitize names the svgconv sanitize policy applied to the SVG
+	// generate_diagram returns inline (strict, standard or relaxed), or is
+	// "off".
+	SVGSanitize string
+
+	// KrokiBackends are additional Kroki servers next to KrokiHost, in the
+	// kroki.ParseBackend syntax.
+	KrokiBackends []string
+
+	// HTTP transport settings for requests to Kroki.
+	KrokiTimeout            time.Duration
+	KrokiDialTimeout        time.Duration
+	KrokiIdleConnTimeout    time.Duration
+	KrokiProxy              string
+	KrokiCACert             string
+	KrokiClientCert         string
+	KrokiClientKey          string
+	KrokiInsecureSkipVerify bool
+
+	// Retry and circuit breaker settings for Kroki renders.
+	KrokiMaxAttempts      int
+	KrokiRetryBackoff     time.Duration
+	KrokiRetryMaxBackoff  time.Duration
+	KrokiBreakerThreshold int
+	KrokiBreakerTimeout   time.Duration
+
+	// Render cache: an in-memory LRU tier and an optional on-disk tier.
+	CacheEntries     int
+	CacheDir         string
+	CacheDirMaxBytes int64
+	CacheTTL         time.Duration
+
+	// Authentication for the network modes: static bearer tokens from
+	// AuthTokenFile or AuthTokens (the KROKI_MCP_AUTH_TOKENS environment
+	// variable or the config file's auth-tokens), and OAuth 2.1 access
+	// tokens validated against the AuthJWKS key set.
+	AuthTokenFile            string
+	AuthTokens               []string
+	AuthJWKS                 string
+	AuthIssuer               string
+	AuthAudience             string
+	AuthResource             string
+	AuthAuthorizationServers []string
+	AuthScopes               []string
+
+	// ShutdownTimeout is the drain period on SIGINT/SIGTERM in the network
+	// modes: in-flight renders get this long to finish before they are
+	// cancelled and the MCP sessions are closed.
+	ShutdownTimeout time.Duration
+
+	// ReadinessTimeout bounds the Kroki /health probes behind /readyz.
+	ReadinessTimeout time.Duration
+	// DiscoveryInterval is how often the diagram types the Kroki backends
+	// render are discovered from their /health endpoints; 0 disables
+	// discovery, advertising every type.
+	DiscoveryInterval time.Duration
+
+	// SessionIdleTimeout drops Streamable HTTP sessions the client
+	// abandoned without ending them.
+	SessionIdleTimeout time.Duration
+
+	// OpenTelemetry tracing: the span exporter (none, otlp or stdout), the
+	// OTLP/HTTP endpoint and the fraction of new traces sampled.
+	TraceExporter    string
+	TraceEndpoint    string
+	TraceSampleRatio float64
 }
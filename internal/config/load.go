@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"go.yaml.in/yaml/v3"
+)
+
+// EnvPrefix starts the environment variable of every setting: the flag
+// --kroki-host is read from KROKI_MCP_KROKI_HOST.
+const EnvPrefix = "KROKI_MCP_"
+
+// FileFlag and PrintFlag name the flags that select the configuration file
+// and print the effective configuration. They are not settings themselves.
+const (
+	FileFlag  = "config"
+	PrintFlag = "print-config"
+)
+
+// secretAnnotation marks flags whose values Print redacts.
+const secretAnnotation = "kroki-mcp/secret"
+
+// MarkSecret makes Print redact the value of the flag name.
+func MarkSecret(fs *pflag.FlagSet, name string) error {
+	return fs.SetAnnotation(name, secretAnnotation, []string{"true"})
+}
+
+// Load fills in the flags of fs that were not given on the command line,
+// in order of precedence, from the KROKI_MCP_* environment variables and
+// from the configuration file named by --config (or KROKI_MCP_CONFIG); flags
+// set nowhere keep their defaults. fs must already be parsed.
+//
+// Every flag is a setting: the file uses the flag names as keys (YAML, JSON
+// or TOML by extension; underscores may stand for dashes) and list settings
+// take lists, while environment variables take lists comma-separated, or
+// newline-separated for repeatable flags such as --kroki-backend, whose
+// values contain commas. Unknown
+// keys in the file are an error, so typos do not go unnoticed.
+func Load(fs *pflag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	if path := FilePath(fs, lookupEnv); path != "" {
+		settings, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		for key, value := range settings {
+			if err := setFromFile(fs, lookupEnv, key, value); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !isSetting(f.Name) {
+			return
+		}
+		value, ok := lookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		sep := ","
+		if f.Value.Type() == "stringArray" {
+			sep = "\n"
+		}
+		if setErr := set(f, splitList(value, sep), value); setErr != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// FilePath returns the configuration file named by --config or
+// KROKI_MCP_CONFIG, or "" when there is none.
+func FilePath(fs *pflag.FlagSet, lookupEnv func(string) (string, bool)) string {
+	if fs.Changed(FileFlag) {
+		path, _ := fs.GetString(FileFlag)
+		return path
+	}
+	path, _ := lookupEnv(envName(FileFlag))
+	return path
+}
+
+func envName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+func isSetting(flag string) bool {
+	return flag != FileFlag && flag != PrintFlag
+}
+
+// readFile decodes the configuration file at path into a map keyed by
+// setting name.
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	settings := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&settings)
+	case ".toml":
+		err = toml.Unmarshal(data, &settings)
+	default:
+		return nil, fmt.Errorf("config file %q: unsupported extension %q (want .yaml, .yml, .json or .toml)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %q: %w", path, err)
+	}
+	return settings, nil
+}
+
+// setFromFile applies one file setting, unless the command line or the
+// environment set it.
+func setFromFile(fs *pflag.FlagSet, lookupEnv func(string) (string, bool), key string, value any) error {
+	name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+	f := fs.Lookup(name)
+	if f == nil || !isSetting(name) {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if f.Changed {
+		return nil
+	}
+	if _, ok := lookupEnv(envName(name)); ok {
+		return nil
+	}
+
+	var list []string
+	var scalar string
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			s, err := scalarString(item)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			list = append(list, s)
+		}
+		if _, isList := f.Value.(pflag.SliceValue); !isList {
+			return fmt.Errorf("%s: got a list, want a single value", key)
+		}
+	default:
+		s, err := scalarString(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		scalar, list = s, []string{s}
+	}
+	if err := set(f, list, scalar); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// set assigns list to a list flag and scalar to any other flag.
+func set(f *pflag.Flag, list []string, scalar string) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.Replace(list)
+	}
+	return f.Value.Set(scalar)
+}
+
+func scalarString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64, json.Number:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// splitList splits an environment variable value separated by sep.
+func splitList(s, sep string) []string {
+	var list []string
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Print writes the effective value of every setting in fs to w as YAML,
+// usable as a --config file. Secret settings are redacted, as are passwords
+// in URLs.
+func Print(w io.Writer, fs *pflag.FlagSet) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err != nil || !isSetting(f.Name) {
+			return
+		}
+		var value any
+		value, err = printable(f)
+		if err != nil {
+			return
+		}
+		var node yaml.Node
+		if err = node.Encode(value); err != nil {
+			return
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.Name}, &node)
+	})
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redacted replaces the values of secret settings in Print's output.
+const redacted = "REDACTED"
+
+// printable returns the value of f typed for YAML output.
+func printable(f *pflag.Flag) (any, error) {
+	secret := slices.Contains(f.Annotations[secretAnnotation], "true")
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		list := slices.Clone(slice.GetSlice())
+		for i, item := range list {
+			if secret {
+				list[i] = redacted
+			} else {
+				list[i] = redactURL(item)
+			}
+		}
+		return list, nil
+	}
+	s := f.Value.String()
+	switch {
+	case secret && s != "":
+		return redacted, nil
+	case f.Value.Type() == "bool":
+		return strconv.ParseBool(s)
+	case f.Value.Type() == "int" || f.Value.Type() == "int64":
+		return strconv.ParseInt(s, 10, 64)
+	case f.Value.Type() == "float64":
+		return strconv.ParseFloat(s, 64)
+	default:
+		return redactURL(s), nil
+	}
+}
+
+// redactURL hides the password of a URL, including one leading a
+// --kroki-backend spec, leaving other values as they are.
+func redactURL(s string) string {
+	rawURL, rest, _ := strings.Cut(s, ";")
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return s
+	}
+	if rest != "" {
+		return u.Redacted() + ";" + rest
+	}
+	return u.Redacted()
+}
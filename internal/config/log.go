@@ -6,17 +6,22 @@ import (
 	"strings"
 )
 
+// logLevel is the level of the logger InitLogger installs, changed at
+// runtime by SetLogLevel.
+var logLevel = new(slog.LevelVar)
+
 func InitLogger(level, format string) *slog.Logger {
 	var handler slog.Handler
 
+	logLevel.Set(parseLevel(level))
 	switch strings.ToLower(format) {
 	case "json":
 		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
-			Level: parseLevel(level),
+			Level: logLevel,
 		})
 	default:
 		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-			Level: parseLevel(level),
+			Level: logLevel,
 		})
 	}
 	logger := slog.New(handler)
@@ -24,6 +29,12 @@ func InitLogger(level, format string) *slog.Logger {
 	return logger
 }
 
+// SetLogLevel changes the level of the logger InitLogger installed, e.g. on
+// a configuration reload.
+func SetLogLevel(level string) {
+	logLevel.Set(parseLevel(level))
+}
+
 func parseLevel(level string) slog.Level {
 	switch strings.ToLower(level) {
 	case "debug":
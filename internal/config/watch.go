@@ -0,0 +1,87 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce collapses the bursts of events a single save produces, such
+// as an editor truncating and then writing the file.
+const watchDebounce = 100 * time.Millisecond
+
+// Watch calls onChange after the file at path was written, replaced or
+// recreated, until ctx ends. It watches the directory rather than the file,
+// so editors and tools that save by renaming a new file over the old one
+// are noticed too. As a Kubernetes ConfigMap mount updates path by swapping
+// the ..data symlink it points through, which produces no event named path,
+// any event in the directory also re-resolves path and counts as a change
+// when the file it leads to differs.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch config file: %w", err)
+	}
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch config file: %w", err)
+	}
+
+	last := statTarget(path)
+	go func() {
+		defer watcher.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				current := statTarget(path)
+				if current != last || filepath.Clean(event.Name) == path && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					debounce = time.After(watchDebounce)
+				}
+				last = current
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Config file watch error", "path", path, "error", err)
+			case <-debounce:
+				debounce = nil
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// targetState identifies the file a path resolves to and its content
+// version.
+type targetState struct {
+	target  string
+	modTime time.Time
+	size    int64
+}
+
+// statTarget returns the state of the file path leads to through any
+// symlinks, or the zero state when it does not resolve.
+func statTarget(path string) targetState {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return targetState{}
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return targetState{}
+	}
+	return targetState{target: target, modTime: info.ModTime(), size: info.Size()}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("log-level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	if err := Watch(ctx, path, func() { changes <- struct{}{} }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	expect := func(t *testing.T, what string, want bool) {
+		t.Helper()
+		select {
+		case <-changes:
+			if !want {
+				t.Errorf("%s: unexpected change notification", what)
+			}
+		case <-time.After(time.Second):
+			if want {
+				t.Errorf("%s: no change notification", what)
+			}
+		}
+	}
+
+	// Other files in the directory are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "writing another file", false)
+
+	// A burst of writes is reported once.
+	for _, level := range []string{"debug", "warn", "error"} {
+		if err := os.WriteFile(path, []byte("log-level: "+level+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(t, "writing the file", true)
+	expect(t, "after the debounced burst", false)
+
+	// Saving by renaming a new file over the old one is noticed.
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	if err := os.WriteFile(tmp, []byte("log-level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "replacing the file", true)
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("log-level: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "writing after ctx ended", false)
+}
+
+// TestWatch_ConfigMap updates the file the way the kubelet updates a
+// ConfigMap mount: path links through the ..data symlink, which is swapped
+// to a new timestamped directory.
+func TestWatch_ConfigMap(t *testing.T) {
+	dir := t.TempDir()
+	version := func(name, content string) {
+		t.Helper()
+		if err := os.Mkdir(filepath.Join(dir, name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "config.yaml"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(name, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version("..2026_10_18_10_00_00.1", "log-level: info\n")
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	if err := Watch(ctx, path, func() { changes <- struct{}{} }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	version("..2026_10_18_10_05_00.2", "log-level: debug\n")
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("swapping ..data: no change notification")
+	}
+	select {
+	case <-changes:
+		t.Error("swapping ..data: notified twice")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
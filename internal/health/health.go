@@ -0,0 +1,113 @@
+// Package health serves the probe and build information endpoints of the
+// network modes: /healthz, /readyz and /version.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/kroki"
+)
+
+// Checker probes the Kroki backends; *kroki.KrokiClient implements it.
+type Checker interface {
+	CheckHealth(ctx context.Context) []kroki.BackendHealth
+}
+
+// Liveness answers 200 while the process can serve HTTP at all.
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// readiness is the /readyz response body.
+type readiness struct {
+	Status   string                `json:"status"`
+	Backends []kroki.BackendHealth `json:"backends"`
+}
+
+// Readiness answers 200 when at least one Kroki backend passes its /health
+// check within timeout, and 503 otherwise. One healthy backend is enough
+// because renders fail over between backends. The body lists each
+// backend's result.
+func Readiness(checker Checker, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		backends := checker.CheckHealth(ctx)
+
+		if slices.ContainsFunc(backends, func(b kroki.BackendHealth) bool { return b.Healthy }) {
+			writeJSON(w, http.StatusOK, readiness{Status: "ready", Backends: backends})
+			return
+		}
+		slog.Warn("Not ready: no Kroki backend is healthy", "backends", backends)
+		writeJSON(w, http.StatusServiceUnavailable, readiness{Status: "not ready", Backends: backends})
+	})
+}
+
+// VersionInfo is the /version response body.
+type VersionInfo struct {
+	Version      string          `json:"version"`
+	GoVersion    string          `json:"goVersion"`
+	MCPGoVersion string          `json:"mcpGoVersion"`
+	Backends     []kroki.Backend `json:"backends"`
+	// Engines lists the versions each backend reported for Kroki and its
+	// diagram engines, keyed by backend URL.
+	Engines map[string]map[string]string `json:"engines,omitempty"`
+}
+
+// NewVersionInfo describes this build. version is the release version set
+// at link time; when it is empty, the module version recorded in the build
+// information is used (set by go install), else "devel".
+func NewVersionInfo(version string) VersionInfo {
+	info := VersionInfo{
+		Version:      version,
+		GoVersion:    runtime.Version(),
+		MCPGoVersion: "unknown",
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, dep := range build.Deps {
+			if dep.Path == "github.com/mark3labs/mcp-go" {
+				info.MCPGoVersion = dep.Version
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+// Version serves info with the Kroki backends in use and the engine
+// versions they last reported, which backends and engines return per
+// request since a configuration reload or a discovery may change them.
+// engines may be nil.
+func Version(info VersionInfo, backends func() []kroki.Backend, engines func() map[string]map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := info
+		info.Backends = backends()
+		if engines != nil {
+			info.Engines = engines()
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Debug("Failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/kroki"
+)
+
+// checkerFunc adapts a function to Checker.
+type checkerFunc func(ctx context.Context) []kroki.BackendHealth
+
+func (f checkerFunc) CheckHealth(ctx context.Context) []kroki.BackendHealth { return f(ctx) }
+
+func serve(t *testing.T, h http.Handler) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q is not JSON: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestLiveness(t *testing.T) {
+	if code, body := serve(t, Liveness()); code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("Liveness = %d %v, want 200 ok", code, body)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		backends   []kroki.BackendHealth
+		wantStatus int
+	}{
+		{
+			name:       "one healthy backend",
+			backends:   []kroki.BackendHealth{{URL: "http://a", Healthy: false}, {URL: "http://b", Healthy: true}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no healthy backend",
+			backends:   []kroki.BackendHealth{{URL: "http://a", Error: "connection refused"}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deadline time.Time
+			checker := checkerFunc(func(ctx context.Context) []kroki.BackendHealth {
+				deadline, _ = ctx.Deadline()
+				return tt.backends
+			})
+			code, body := serve(t, Readiness(checker, time.Second))
+			if code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", code, tt.wantStatus)
+			}
+			if backends, _ := body["backends"].([]any); len(backends) != len(tt.backends) {
+				t.Errorf("body = %v, want %d backends", body, len(tt.backends))
+			}
+			if deadline.IsZero() || time.Until(deadline) > time.Second {
+				t.Errorf("probe deadline %v does not honor the 1s timeout", deadline)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	backends := []kroki.Backend{{URL: "http://kroki:8000"}}
+	var engines map[string]map[string]string
+	handler := Version(NewVersionInfo("v9.9.9"), func() []kroki.Backend { return backends }, func() map[string]map[string]string { return engines })
+	code, body := serve(t, handler)
+	if code != http.StatusOK || body["version"] != "v9.9.9" || body["goVersion"] == "" || body["mcpGoVersion"] == "" {
+		t.Errorf("Version = %d %v", code, body)
+	}
+	if listed, _ := body["backends"].([]any); len(listed) != 1 {
+		t.Errorf("backends = %v, want the configured backend", body["backends"])
+	}
+
+	if _, ok := body["engines"]; ok {
+		t.Errorf("engines = %v before any discovery, want none", body["engines"])
+	}
+
+	// The backends and engines are read per request, so a reload or a
+	// discovery shows up.
+	backends = append(backends, kroki.Backend{URL: "https://kroki.io", Public: true, Fallback: true})
+	engines = map[string]map[string]string{"http://kroki:8000": {"kroki": "0.28.0", "mermaid": "11.4.1"}}
+	_, body = serve(t, handler)
+	if listed, _ := body["backends"].([]any); len(listed) != 2 || listed[1].(map[string]any)["public"] != true {
+		t.Errorf("backends after reload = %v, want both configured backends", body["backends"])
+	}
+	if listed, _ := body["engines"].(map[string]any); listed["http://kroki:8000"] == nil {
+		t.Errorf("engines = %v, want the discovered versions", body["engines"])
+	}
+
+	if got := NewVersionInfo("").Version; got == "" {
+		t.Error("NewVersionInfo without a version left it empty")
+	}
+}
@@ -0,0 +1,164 @@
+package kroki
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Backend describes one Kroki server a KrokiClient can send renders to.
+type Backend struct {
+	// URL is the Kroki server's base URL.
+	URL string `json:"url"`
+	// DiagramTypes restricts the backend to these diagram types, e.g. a
+	// companion container serving only bpmn and excalidraw. Backends that
+	// list a type explicitly take precedence over catch-all backends (those
+	// with an empty list) for it.
+	DiagramTypes []string `json:"diagramTypes,omitempty"`
+	// Public marks the backend whose URL GetDiagramURL prefers, so links
+	// handed to users point at a host they can reach.
+	Public bool `json:"public,omitempty"`
+	// Fallback backends only receive renders when every regular backend for
+	// the diagram type is failing.
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// ParseBackend parses the --kroki-backend flag syntax:
+//
+//	URL[;types=TYPE,TYPE...][;public][;fallback]
+//
+// e.g. "http://companion:8000;types=bpmn,excalidraw" or
+// "https://kroki.io;public;fallback".
+func ParseBackend(spec string) (Backend, error) {
+	parts := strings.Split(spec, ";")
+	b := Backend{URL: strings.TrimSpace(parts[0])}
+	if b.URL == "" {
+		return Backend{}, fmt.Errorf("invalid backend %q: missing URL", spec)
+	}
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(key) {
+		case "types":
+			for _, t := range strings.Split(value, ",") {
+				if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+					b.DiagramTypes = append(b.DiagramTypes, t)
+				}
+			}
+			if len(b.DiagramTypes) == 0 {
+				return Backend{}, fmt.Errorf("invalid backend %q: empty types list", spec)
+			}
+		case "public":
+			b.Public = true
+		case "fallback":
+			b.Fallback = true
+		default:
+			return Backend{}, fmt.Errorf("invalid backend %q: unknown attribute %q", spec, key)
+		}
+	}
+	return b, nil
+}
+
+// WithBackends adds Kroki servers next to the host passed to NewKrokiClient,
+// which stays the first, catch-all backend.
+func WithBackends(backends ...Backend) Option {
+	return func(o *clientOptions) { o.backends = append(o.backends, backends...) }
+}
+
+// backend is a Backend together with the circuit breaker tracking its
+// health.
+type backend struct {
+	Backend
+	breaker *circuitBreaker
+}
+
+// serves reports whether b lists diagramType explicitly (specific) or
+// accepts every type (catchAll).
+func (b *backend) serves(diagramType string) (specific, catchAll bool) {
+	if len(b.DiagramTypes) == 0 {
+		return false, true
+	}
+	return slices.Contains(b.DiagramTypes, diagramType), false
+}
+
+// candidates returns the backends eligible for diagramType: the backends
+// listing it explicitly if there are any, otherwise the catch-all ones.
+func (kc *KrokiClient) candidates(diagramType string) []*backend {
+	var specific, catchAll []*backend
+	for _, b := range kc.allBackends() {
+		s, c := b.serves(diagramType)
+		switch {
+		case s:
+			specific = append(specific, b)
+		case c:
+			catchAll = append(catchAll, b)
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	return catchAll
+}
+
+// renderOrder returns the order in which a render of diagramType tries the
+// backends: healthy regular backends in round-robin order, then healthy
+// fallbacks, then the unhealthy ones, whose open circuits fail fast but
+// still report why nothing is available.
+func (kc *KrokiClient) renderOrder(diagramType string) []*backend {
+	candidates := kc.candidates(diagramType)
+	var regular, fallback, unhealthy []*backend
+	for _, b := range candidates {
+		switch {
+		case !b.breaker.healthy():
+			unhealthy = append(unhealthy, b)
+		case b.Fallback:
+			fallback = append(fallback, b)
+		default:
+			regular = append(regular, b)
+		}
+	}
+	if n := len(regular); n > 1 {
+		start := int(kc.next.Add(1) % uint64(n))
+		regular = slices.Concat(regular[start:], regular[:start])
+	}
+	return slices.Concat(regular, fallback, unhealthy)
+}
+
+// urlBackend returns the backend GetDiagramURL builds links against: a
+// public backend for diagramType if one is configured, else the first
+// regular one, else any fallback.
+func (kc *KrokiClient) urlBackend(diagramType string) (*backend, bool) {
+	candidates := kc.candidates(diagramType)
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	for _, b := range candidates {
+		if b.Public {
+			return b, true
+		}
+	}
+	for _, b := range candidates {
+		if !b.Fallback {
+			return b, true
+		}
+	}
+	return candidates[0], true
+}
+
+// allBackends returns the configured backends, or a single one for Host
+// when the KrokiClient was built as a struct literal.
+func (kc *KrokiClient) allBackends() []*backend {
+	if len(kc.backends) > 0 {
+		return kc.backends
+	}
+	return []*backend{{Backend: Backend{URL: kc.Host}, breaker: newCircuitBreaker(kc.Host, CircuitBreakerSettings{})}}
+}
+
+// Backends returns the configured backends, the host passed to
+// NewKrokiClient first.
+func (kc *KrokiClient) Backends() []Backend {
+	var backends []Backend
+	for _, b := range kc.allBackends() {
+		backends = append(backends, b.Backend)
+	}
+	return backends
+}
@@ -0,0 +1,150 @@
+package kroki
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+func TestParseBackend(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Backend
+		wantErr bool
+	}{
+		{spec: "http://kroki:8000", want: Backend{URL: "http://kroki:8000"}},
+		{
+			spec: "http://companion:8000;types=BPMN, excalidraw",
+			want: Backend{URL: "http://companion:8000", DiagramTypes: []string{"bpmn", "excalidraw"}},
+		},
+		{spec: "https://kroki.io;public;fallback", want: Backend{URL: "https://kroki.io", Public: true, Fallback: true}},
+		{spec: ";public", wantErr: true},
+		{spec: "http://kroki:8000;types=", wantErr: true},
+		{spec: "http://kroki:8000;primary", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBackend(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseBackend(%q) = %+v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseBackend(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseBackend(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// newCountingKrokiHost answers every request with status and counts them.
+func newCountingKrokiHost(t *testing.T, status int) (string, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte("fake-image-bytes"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, &hits
+}
+
+func TestRenderDiagram_RoutesByDiagramType(t *testing.T) {
+	mainHost, mainHits := newCountingKrokiHost(t, http.StatusOK)
+	companion, companionHits := newCountingKrokiHost(t, http.StatusOK)
+	client := newTestClient(t, mainHost, WithBackends(Backend{URL: companion, DiagramTypes: []string{"bpmn"}}))
+
+	for _, diagramType := range []string{"bpmn", "plantuml", "bpmn"} {
+		if _, err := client.RenderDiagram(diagramType, "source", model.SVG, nil); err != nil {
+			t.Fatalf("RenderDiagram(%s): %v", diagramType, err)
+		}
+	}
+	if got := companionHits.Load(); got != 2 {
+		t.Errorf("companion requests = %d, want 2", got)
+	}
+	if got := mainHits.Load(); got != 1 {
+		t.Errorf("main requests = %d, want 1", got)
+	}
+}
+
+func TestRenderDiagram_RoundRobin(t *testing.T) {
+	first, firstHits := newCountingKrokiHost(t, http.StatusOK)
+	second, secondHits := newCountingKrokiHost(t, http.StatusOK)
+	client := newTestClient(t, first, WithBackends(Backend{URL: second}))
+
+	for range 4 {
+		if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err != nil {
+			t.Fatalf("RenderDiagram: %v", err)
+		}
+	}
+	if firstHits.Load() != 2 || secondHits.Load() != 2 {
+		t.Errorf("requests = %d/%d, want 2/2", firstHits.Load(), secondHits.Load())
+	}
+}
+
+func TestRenderDiagram_FailsOverToFallback(t *testing.T) {
+	down, downHits := newCountingKrokiHost(t, http.StatusServiceUnavailable)
+	fallback, fallbackHits := newCountingKrokiHost(t, http.StatusOK)
+	client := newTestClient(t, down,
+		WithBackends(Backend{URL: fallback, Fallback: true}),
+		WithCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 1, OpenTimeout: time.Minute}),
+	)
+
+	for range 3 {
+		if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err != nil {
+			t.Fatalf("RenderDiagram: %v", err)
+		}
+	}
+	// The first render fails over within the attempt; afterwards the open
+	// circuit routes straight to the fallback.
+	if got := downHits.Load(); got != 1 {
+		t.Errorf("requests to failing backend = %d, want 1", got)
+	}
+	if got := fallbackHits.Load(); got != 3 {
+		t.Errorf("requests to fallback = %d, want 3", got)
+	}
+}
+
+func TestRenderDiagram_NoBackendForType(t *testing.T) {
+	client := newTestClient(t, "http://unused.invalid")
+	client.backends[0].DiagramTypes = []string{"plantuml"}
+
+	_, err := client.RenderDiagram("bpmn", "<xml/>", model.SVG, nil)
+	if err == nil || !strings.Contains(err.Error(), `no Kroki backend is configured for diagram type "bpmn"`) {
+		t.Errorf("RenderDiagram error = %v, want a missing-backend error", err)
+	}
+}
+
+func TestGetDiagramURL_PrefersPublicBackend(t *testing.T) {
+	client := newTestClient(t, "http://kroki.internal:8000", WithBackends(
+		Backend{URL: "https://kroki.io", Public: true, Fallback: true},
+		Backend{URL: "http://companion:8000", DiagramTypes: []string{"bpmn"}},
+	))
+
+	got, err := client.GetDiagramURL("plantuml", "A -> B", model.SVG, nil)
+	if err != nil {
+		t.Fatalf("GetDiagramURL: %v", err)
+	}
+	if !strings.HasPrefix(got, "https://kroki.io/plantuml/svg/") {
+		t.Errorf("URL = %q, want it on the public backend", got)
+	}
+
+	// bpmn is only served by the companion, so links point there.
+	got, err = client.GetDiagramURL("bpmn", "<xml/>", model.SVG, nil)
+	if err != nil {
+		t.Fatalf("GetDiagramURL: %v", err)
+	}
+	if !strings.HasPrefix(got, "http://companion:8000/bpmn/svg/") {
+		t.Errorf("URL = %q, want it on the companion backend", got)
+	}
+}
@@ -0,0 +1,175 @@
+package kroki
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CircuitBreakerSettings configures the circuit breaker guarding a Kroki
+// host. A zero FailureThreshold disables the breaker.
+type CircuitBreakerSettings struct {
+	// FailureThreshold is the number of consecutive failed requests (network
+	// errors, 429 or 5xx responses) that opens the circuit.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a single trial
+	// request is let through to probe whether the host recovered.
+	OpenTimeout time.Duration
+}
+
+// WithCircuitBreaker fails renders fast with ErrCircuitOpen while Kroki is
+// known to be down, instead of letting every call wait for its own timeout.
+func WithCircuitBreaker(settings CircuitBreakerSettings) Option {
+	return func(o *clientOptions) { o.breaker = settings }
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitOpenError is returned without contacting Kroki while the circuit
+// for host is open.
+type CircuitOpenError struct {
+	Host       string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("kroki server %s is unavailable after repeated failures; not retrying for another %s",
+		e.Host, e.RetryAfter.Round(time.Second))
+}
+
+// circuitBreaker is a consecutive-failure breaker. Closed lets every request
+// through; FailureThreshold failures in a row open it; after OpenTimeout it is
+// half-open and admits one trial request, whose outcome closes or re-opens it.
+type circuitBreaker struct {
+	host     string
+	settings CircuitBreakerSettings
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+}
+
+func newCircuitBreaker(host string, settings CircuitBreakerSettings) *circuitBreaker {
+	return &circuitBreaker{host: host, settings: settings, now: time.Now}
+}
+
+// allow reports whether a request may be sent, returning a
+// *CircuitOpenError when it may not.
+func (b *circuitBreaker) allow() error {
+	if b.settings.FailureThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.settings.OpenTimeout {
+			return &CircuitOpenError{Host: b.host, RetryAfter: b.settings.OpenTimeout - elapsed}
+		}
+		b.transition(breakerHalfOpen)
+		b.trial = true
+		return nil
+	case breakerHalfOpen:
+		if b.trial {
+			return &CircuitOpenError{Host: b.host, RetryAfter: b.settings.OpenTimeout}
+		}
+		b.trial = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record feeds the outcome of a request admitted by allow back into the
+// breaker. Only errors that indicate an unhealthy host count as failures; a
+// 4xx for a broken diagram source is a success from the breaker's point of
+// view.
+func (b *circuitBreaker) record(err error) {
+	if b.settings.FailureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !retryable(err) {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.transition(breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.openedAt = b.now()
+		if b.state != breakerOpen {
+			b.transition(breakerOpen)
+		}
+	}
+}
+
+// healthy reports whether the breaker would currently admit a request,
+// without claiming the half-open trial slot.
+func (b *circuitBreaker) healthy() bool {
+	if b.settings.FailureThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return b.now().Sub(b.openedAt) >= b.settings.OpenTimeout
+	case breakerHalfOpen:
+		return !b.trial
+	default:
+		return true
+	}
+}
+
+// release gives back a half-open trial slot claimed by allow without
+// recording an outcome, for requests aborted by their caller: those say
+// nothing about the host's health.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// transition changes state and logs it; b.mu must be held.
+func (b *circuitBreaker) transition(to breakerState) {
+	from := b.state
+	b.state = to
+	switch to {
+	case breakerOpen:
+		slog.Warn("Kroki circuit breaker opened", "host", b.host, "from", from.String(),
+			"consecutiveFailures", b.failures, "openTimeout", b.settings.OpenTimeout)
+	case breakerHalfOpen:
+		slog.Info("Kroki circuit breaker half-open, sending trial request", "host", b.host)
+	default:
+		slog.Info("Kroki circuit breaker closed", "host", b.host, "from", from.String())
+	}
+}
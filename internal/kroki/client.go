@@ -3,6 +3,7 @@ package kroki
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,12 +12,38 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/utain/kroki-mcp/internal/model"
+	"github.com/utain/kroki-mcp/internal/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type KrokiClient struct {
+	// Host is the primary Kroki server; further backends are added with
+	// WithBackends.
 	Host string
+
+	httpClient *http.Client
+	retry      RetryPolicy
+	backends   []*backend
+	next       atomic.Uint64 // round-robin position across regular backends
+	observe    RequestObserver
+}
+
+// RequestObserver is told about every request sent to a Kroki backend, with
+// the backend URL, the response status code (0 when no response arrived) and
+// how long the request took. It must be safe for concurrent use.
+type RequestObserver func(backend string, statusCode int, elapsed time.Duration)
+
+// WithRequestObserver reports every Kroki request, retries and failovers
+// included, to observe, e.g. to export request metrics.
+func WithRequestObserver(observe RequestObserver) Option {
+	return func(o *clientOptions) { o.observe = observe }
 }
 
 type KrokiResult struct {
@@ -32,10 +59,38 @@ type krokiRequest struct {
 	DiagramOptions map[string]string `json:"diagram_options"`
 }
 
-func NewKrokiClient(host string) *KrokiClient {
-	return &KrokiClient{
-		Host: host,
+// NewKrokiClient returns a client for the Kroki server at host. Without
+// options it uses the http.DefaultTransport settings and no request timeout;
+// it fails only when an option cannot be applied, such as an unreadable CA
+// bundle or client certificate.
+func NewKrokiClient(host string, opts ...Option) (*KrokiClient, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
+	httpClient, err := newHTTPClient(&o)
+	if err != nil {
+		return nil, err
+	}
+	kc := &KrokiClient{
+		Host:       host,
+		httpClient: httpClient,
+		retry:      o.retry,
+		observe:    o.observe,
+	}
+	for _, b := range append([]Backend{{URL: host}}, o.backends...) {
+		kc.backends = append(kc.backends, &backend{Backend: b, breaker: newCircuitBreaker(b.URL, o.breaker)})
+	}
+	return kc, nil
+}
+
+// client returns the HTTP client for Kroki requests, falling back to
+// http.DefaultClient for a KrokiClient built as a struct literal.
+func (kc *KrokiClient) client() *http.Client {
+	if kc.httpClient != nil {
+		return kc.httpClient
+	}
+	return http.DefaultClient
 }
 
 // encodeDiagram compresses and base64-url encodes the diagram source for GET URLs.
@@ -56,69 +111,204 @@ func (kc *KrokiClient) encodeDiagram(diagramSource string) (string, error) {
 }
 
 // RenderDiagram sends diagram code to the Kroki server and returns both image base64 and a direct URL.
-func (kc *KrokiClient) RenderDiagram(diagramType, diagramSource string, format model.OutputFormat) (*KrokiResult, error) {
-	u, err := url.Parse(kc.Host)
-	if err != nil {
-		slog.Error("Invalid Kroki host URL", "host", kc.Host, "error", err)
-		return nil, err
-	}
+// options are Kroki diagram options (e.g. a Mermaid theme or Graphviz
+// layout engine) and may be nil. It is RenderDiagramContext with
+// context.Background().
+func (kc *KrokiClient) RenderDiagram(diagramType, diagramSource string, format model.OutputFormat, options map[string]string) (*KrokiResult, error) {
+	return kc.RenderDiagramContext(context.Background(), diagramType, diagramSource, format, options)
+}
 
+// RenderDiagramContext is RenderDiagram bound to ctx: cancelling ctx, or
+// reaching its deadline, aborts the in-flight Kroki request and returns the
+// context's error.
+//
+// Each attempt goes to the backends serving diagramType in turn (see
+// WithBackends), moving on to the next one when a backend fails with a
+// retryable error or has its circuit breaker open. When every backend failed,
+// the attempt is repeated after a backoff according to the client's
+// RetryPolicy.
+func (kc *KrokiClient) RenderDiagramContext(ctx context.Context, diagramType, diagramSource string, format model.OutputFormat, options map[string]string) (result *KrokiResult, err error) {
+	ctx, span := telemetry.Start(ctx, "kroki.RenderDiagram", trace.WithAttributes(
+		attribute.String("kroki.diagram_type", diagramType),
+		attribute.String("kroki.output_format", string(format)),
+	))
+	defer func() { telemetry.End(span, err) }()
+
+	if options == nil {
+		options = map[string]string{}
+	}
 	var buf bytes.Buffer
 	err = json.NewEncoder(&buf).Encode(&krokiRequest{
 		DiagramSource:  diagramSource,
 		DiagramType:    diagramType,
 		OutputFormat:   string(format),
-		DiagramOptions: map[string]string{},
+		DiagramOptions: options,
 	})
 	if err != nil {
 		slog.Error("Failed to encode Kroki request", "error", err)
 		return nil, err
 	}
 
-	// POST to get image content
-	req, err := http.NewRequest("POST", u.String(), &buf)
+	attempts := max(kc.retry.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		backends := kc.renderOrder(diagramType)
+		if len(backends) == 0 {
+			return nil, fmt.Errorf("no Kroki backend is configured for diagram type %q", diagramType)
+		}
+
+		// err keeps the most telling failure of this attempt: a real error
+		// from one backend is not hidden by another's open circuit.
+		err = nil
+		for _, b := range backends {
+			imageContent, backendErr := kc.renderOnce(ctx, b, diagramType, buf.Bytes())
+			if backendErr == nil {
+				return &KrokiResult{
+					ImageContent: imageContent,
+					MIMEType:     format.MIMEType(),
+				}, nil
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if !retryable(backendErr) && !isCircuitOpen(backendErr) {
+				return nil, backendErr
+			}
+			if err == nil || !isCircuitOpen(backendErr) {
+				err = backendErr
+			}
+			slog.Debug("Kroki backend failed, trying next", "host", b.URL, "error", backendErr)
+		}
+		if attempt >= attempts || !retryable(err) {
+			return nil, err
+		}
+
+		delay := kc.retry.backoff(attempt, err)
+		slog.Warn("Retrying Kroki request", "attempt", attempt+1, "maxAttempts", attempts, "delay", delay, "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// renderOnce sends one render request to b, consulting and updating its
+// circuit breaker.
+func (kc *KrokiClient) renderOnce(ctx context.Context, b *backend, diagramType string, body []byte) ([]byte, error) {
+	if err := b.breaker.allow(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		b.breaker.release()
+		slog.Error("Invalid Kroki host URL", "host", b.URL, "error", err)
+		return nil, err
+	}
+	slog.Debug("Sending Kroki request", "host", b.URL)
+	imageContent, err := kc.post(ctx, u.String(), diagramType, body)
+	if ctx.Err() != nil {
+		b.breaker.release()
+	} else {
+		b.breaker.record(err)
+	}
+	return imageContent, err
+}
+
+// post sends one render request to Kroki and returns the response body,
+// or a *RenderError for a non-200 response. The request carries the trace
+// context of ctx, so a traced Kroki joins the trace.
+func (kc *KrokiClient) post(ctx context.Context, endpoint, diagramType string, body []byte) (_ []byte, err error) {
+	ctx, span := telemetry.Start(ctx, "POST", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("url.full", endpoint),
+	))
+	defer func() { telemetry.End(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
 	if err != nil {
 		slog.Error("Failed to create Kroki request", "error", err)
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "text/plain")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	resp, err := kc.client().Do(req)
+	if kc.observe != nil {
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode
+		}
+		kc.observe(endpoint, statusCode, time.Since(start))
+	}
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			slog.Info("Kroki request aborted", "reason", ctxErr)
+			return nil, ctxErr
+		}
 		slog.Error("Failed to send Kroki request", "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		slog.Error("Kroki request failed", "status", resp.StatusCode, "body", string(body))
-		return nil, fmt.Errorf("kroki error: %s", string(body))
+		renderErr := newRenderError(resp.StatusCode, diagramType, resp.Header, body, time.Now())
+		slog.Error("Kroki request failed", "status", resp.StatusCode, "message", renderErr.Message,
+			"line", renderErr.Line, "column", renderErr.Column)
+		return nil, renderErr
 	}
 	imageContent, err := io.ReadAll(resp.Body)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, err
 	}
-
-	return &KrokiResult{
-		ImageContent: imageContent,
-		MIMEType:     format.MIMEType(),
-	}, nil
+	return imageContent, nil
 }
 
 // GetDiagramURL generates a URL for the Kroki API to fetch the diagram.
-// It encodes the diagram source and appends it to the Kroki host URL.
-func (kc *KrokiClient) GetDiagramURL(diagramType, diagramSource string, format model.OutputFormat) (string, error) {
+// It encodes the diagram source and appends it to the URL of a backend
+// serving diagramType, preferring one marked Public. options are encoded as
+// query parameters. It is GetDiagramURLContext with context.Background().
+func (kc *KrokiClient) GetDiagramURL(diagramType, diagramSource string, format model.OutputFormat, options map[string]string) (string, error) {
+	return kc.GetDiagramURLContext(context.Background(), diagramType, diagramSource, format, options)
+}
+
+// GetDiagramURLContext is GetDiagramURL bound to ctx. URL generation is local
+// encoding with no network I/O, so ctx is only checked up front: a request
+// that was already cancelled does no work.
+func (kc *KrokiClient) GetDiagramURLContext(ctx context.Context, diagramType, diagramSource string, format model.OutputFormat, options map[string]string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	encoded, err := kc.encodeDiagram(diagramSource)
 	if err != nil {
 		slog.Error("Failed to encode diagram source", "error", err)
 		return "", err
 	}
-	u, err := url.Parse(kc.Host)
+	b, ok := kc.urlBackend(diagramType)
+	if !ok {
+		return "", fmt.Errorf("no Kroki backend is configured for diagram type %q", diagramType)
+	}
+	u, err := url.Parse(b.URL)
 	if err != nil {
-		slog.Error("Invalid Kroki host URL", "host", kc.Host, "error", err)
+		slog.Error("Invalid Kroki host URL", "host", b.URL, "error", err)
 		return "", err
 	}
 	u.Path = fmt.Sprintf("/%s/%s/%s", diagramType, string(format), encoded)
+	if len(options) > 0 {
+		query := url.Values{}
+		for name, value := range options {
+			query.Set(name, value)
+		}
+		u.RawQuery = query.Encode()
+	}
 	return u.String(), nil
 }
+
+// CloseIdleConnections closes the client's idle connections to Kroki, e.g.
+// once a configuration reload replaced it, leaving requests in flight alone.
+func (kc *KrokiClient) CloseIdleConnections() {
+	kc.client().CloseIdleConnections()
+}
@@ -1,13 +1,36 @@
 package kroki
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/utain/kroki-mcp/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+// newTestClient builds a KrokiClient for host, failing the test if the
+// options are rejected.
+func newTestClient(t *testing.T, host string, opts ...Option) *KrokiClient {
+	t.Helper()
+	client, err := NewKrokiClient(host, opts...)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	return client
+}
+
 func TestRenderDiagram_MockServer(t *testing.T) {
 	// Mock Kroki server that returns a fixed image
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,10 +39,10 @@ func TestRenderDiagram_MockServer(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	client := NewKrokiClient(ts.URL)
+	client := newTestClient(t, ts.URL)
 	diagramType := "plantuml"
 	diagramSource := "A -> B: test"
-	result, err := client.RenderDiagram(diagramType, diagramSource, model.OutputFormat("svg"))
+	result, err := client.RenderDiagram(diagramType, diagramSource, model.OutputFormat("svg"), nil)
 	if err != nil {
 		t.Fatalf("RenderDiagram error: %v", err)
 	}
@@ -27,3 +50,137 @@ func TestRenderDiagram_MockServer(t *testing.T) {
 		t.Errorf("unexpected image content: %s", string(result.ImageContent))
 	}
 }
+
+func TestRenderDiagramContext_CancelAbortsRequest(t *testing.T) {
+	// Mock Kroki server that never answers until the client goes away
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client hanging up once the body
+		// has been consumed.
+		_, _ = io.Copy(io.Discard, r.Body)
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	client := newTestClient(t, ts.URL)
+	_, err := client.RenderDiagramContext(ctx, "plantuml", "A -> B: test", model.OutputFormat("svg"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RenderDiagramContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGetDiagramURLContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := newTestClient(t, "https://kroki.io")
+	if _, err := client.GetDiagramURLContext(ctx, "plantuml", "A -> B: test", model.OutputFormat("svg"), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetDiagramURLContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGetDiagramURL_EncodesOptionsAsQuery(t *testing.T) {
+	client := newTestClient(t, "https://kroki.io")
+	got, err := client.GetDiagramURL("graphviz", "digraph { a -> b }", model.SVG, map[string]string{
+		"layout":                  "neato",
+		"graph-attribute-rankdir": "LR",
+	})
+	if err != nil {
+		t.Fatalf("GetDiagramURL: %v", err)
+	}
+	if !strings.HasSuffix(got, "?graph-attribute-rankdir=LR&layout=neato") {
+		t.Errorf("URL %q does not end with the encoded options", got)
+	}
+}
+
+func TestWithRequestObserver_ReportsEveryAttempt(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<svg/>"))
+	}))
+	defer ts.Close()
+
+	type observation struct {
+		backend    string
+		statusCode int
+	}
+	var seen []observation
+	client := newTestClient(t, ts.URL,
+		WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+		WithRequestObserver(func(backend string, statusCode int, elapsed time.Duration) {
+			seen = append(seen, observation{backend, statusCode})
+		}),
+	)
+	if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err != nil {
+		t.Fatalf("RenderDiagram error: %v", err)
+	}
+	want := []observation{{ts.URL, http.StatusServiceUnavailable}, {ts.URL, http.StatusOK}}
+	if len(seen) != len(want) || seen[0] != want[0] || seen[1] != want[1] {
+		t.Errorf("observed %v, want %v", seen, want)
+	}
+
+	// A backend that cannot be reached is reported with status 0.
+	seen = nil
+	unreachable := newTestClient(t, "http://127.0.0.1:1",
+		WithRequestObserver(func(backend string, statusCode int, elapsed time.Duration) {
+			seen = append(seen, observation{backend, statusCode})
+		}),
+	)
+	if _, err := unreachable.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err == nil {
+		t.Fatal("RenderDiagram against an unreachable host succeeded")
+	}
+	if len(seen) != 1 || seen[0].statusCode != 0 {
+		t.Errorf("observed %v, want one observation with status 0", seen)
+	}
+}
+
+func TestRenderDiagramContext_Tracing(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.Write([]byte("<svg/>"))
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL)
+	if _, err := client.RenderDiagramContext(context.Background(), "plantuml", "A -> B", model.SVG, nil); err != nil {
+		t.Fatalf("RenderDiagramContext error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "POST" || spans[1].Name() != "kroki.RenderDiagram" {
+		t.Fatalf("ended spans = %v, want POST inside kroki.RenderDiagram", spans)
+	}
+	post := spans[0]
+	if post.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Error("POST span is not a child of kroki.RenderDiagram")
+	}
+	want := fmt.Sprintf("00-%s-%s-01", post.SpanContext().TraceID(), post.SpanContext().SpanID())
+	if received != want {
+		t.Errorf("Kroki received traceparent %q, want %q", received, want)
+	}
+	if !slices.Contains(post.Attributes(), attribute.Int("http.response.status_code", http.StatusOK)) {
+		t.Errorf("POST span attributes = %v, want the response status code", post.Attributes())
+	}
+}
@@ -0,0 +1,103 @@
+package kroki
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// ErrNoHealthyBackend is returned by DiscoverDiagramTypes when no backend
+// answered its /health endpoint, so nothing can be said about the types.
+var ErrNoHealthyBackend = errors.New("no Kroki backend answered its /health endpoint")
+
+// Discovery is what the backends' /health endpoints tell about the diagram
+// types they render.
+type Discovery struct {
+	// DiagramTypes lists the registered types a healthy backend serving
+	// them renders, in registry order.
+	DiagramTypes []string `json:"diagramTypes"`
+	// Backends is the health of each backend, with the versions it reported.
+	Backends []BackendHealth `json:"backends"`
+}
+
+// EngineVersion returns the version of the engine rendering diagramType
+// that the first backend reporting it listed, or "" when none did.
+func (d *Discovery) EngineVersion(diagramType string) string {
+	for _, b := range d.Backends {
+		if v := b.Versions[diagramType]; b.Healthy && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Versions returns the versions each healthy backend reported, keyed by
+// backend URL.
+func (d *Discovery) Versions() map[string]map[string]string {
+	versions := map[string]map[string]string{}
+	for _, b := range d.Backends {
+		if b.Healthy && len(b.Versions) > 0 {
+			versions[b.URL] = b.Versions
+		}
+	}
+	return versions
+}
+
+// DiscoverDiagramTypes probes the /health endpoint of every backend and
+// works out which registered diagram types the backends their renders are
+// routed to render. Kroki renders most types itself, but the companion types
+// only when their container is deployed, which a backend reporting its
+// engines shows by listing the type's engine. A backend whose /health lists
+// no engines at all is assumed to render every type, as nothing says
+// otherwise.
+func (kc *KrokiClient) DiscoverDiagramTypes(ctx context.Context) (*Discovery, error) {
+	health := kc.CheckHealth(ctx)
+	healthOf := map[string]BackendHealth{}
+	for _, h := range health {
+		healthOf[h.URL] = h
+	}
+	d := &Discovery{Backends: health}
+	healthy := false
+	for _, h := range health {
+		healthy = healthy || h.Healthy
+	}
+	if !healthy {
+		return nil, ErrNoHealthyBackend
+	}
+
+	// A type is only available through the backends renders are routed
+	// to, so one whose dedicated backends are all down is not, even when a
+	// catch-all backend is healthy.
+	for _, diagram := range model.Diagrams.Types() {
+		for _, b := range kc.candidates(diagram.Name) {
+			if h := healthOf[b.URL]; h.Healthy && renders(diagram, h.Versions) {
+				d.DiagramTypes = append(d.DiagramTypes, diagram.Name)
+				break
+			}
+		}
+	}
+	return d, nil
+}
+
+// renders reports whether a backend that reported versions renders
+// diagram.
+func renders(diagram model.DiagramType, versions map[string]string) bool {
+	if !diagram.Companion || !reportsEngines(versions) {
+		return true
+	}
+	v := versions[diagram.Name]
+	return v != "" && !strings.EqualFold(v, "unknown")
+}
+
+// reportsEngines reports whether versions lists any diagram engine, not
+// just the Kroki server itself.
+func reportsEngines(versions map[string]string) bool {
+	for name := range versions {
+		if name != "kroki" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package kroki
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// newHealthServer serves body at /health.
+func newHealthServer(t *testing.T, status int, body string) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestDiscoverDiagramTypes(t *testing.T) {
+	// A self-hosted Kroki without its companion containers reports only the
+	// engines it bundles.
+	bare := newHealthServer(t, http.StatusOK, `{"status":"pass","version":{"kroki":{"number":"0.28.0"},"plantuml":"1.2025.4","graphviz":"12.2.1"}}`)
+	companions := newHealthServer(t, http.StatusOK, `{"status":"pass","version":{"kroki":{"number":"0.28.0"},"mermaid":"11.4.1","bpmn":"unknown","excalidraw":"0.18.0"}}`)
+	silent := newHealthServer(t, http.StatusOK, `{"status":"pass"}`)
+	down := newHealthServer(t, http.StatusServiceUnavailable, "")
+	allTypes := model.Diagrams.Names()
+	without := func(names ...string) []string {
+		return slices.DeleteFunc(slices.Clone(allTypes), func(name string) bool { return slices.Contains(names, name) })
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		opts    []Option
+		want    []string
+		wantErr error
+	}{
+		{name: "without companions", host: bare, want: without("bpmn", "excalidraw", "mermaid")},
+		{
+			name: "companion backend for some types",
+			host: bare,
+			opts: []Option{WithBackends(Backend{URL: companions, DiagramTypes: []string{"mermaid", "bpmn"}})},
+			want: without("bpmn", "excalidraw"),
+		},
+		{name: "no engines reported", host: silent, want: allTypes},
+		{
+			name: "dedicated backend down",
+			host: silent,
+			opts: []Option{WithBackends(Backend{URL: down, DiagramTypes: []string{"graphviz"}, Fallback: true})},
+			want: without("graphviz"),
+		},
+		{name: "unhealthy backends are skipped", host: down, opts: []Option{WithBackends(Backend{URL: bare})}, want: without("bpmn", "excalidraw", "mermaid")},
+		{name: "no healthy backend", host: down, wantErr: ErrNoHealthyBackend},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newTestClient(t, tt.host, tt.opts...).DiscoverDiagramTypes(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DiscoverDiagramTypes error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(d.DiagramTypes, tt.want) {
+				t.Errorf("DiagramTypes = %v, want %v", d.DiagramTypes, tt.want)
+			}
+		})
+	}
+
+	d, err := newTestClient(t, down, WithBackends(Backend{URL: bare}, Backend{URL: companions})).DiscoverDiagramTypes(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverDiagramTypes: %v", err)
+	}
+	if got := d.EngineVersion("mermaid"); got != "11.4.1" {
+		t.Errorf("EngineVersion(mermaid) = %q, want 11.4.1", got)
+	}
+	if versions := d.Versions(); len(versions) != 2 || versions[bare]["plantuml"] != "1.2025.4" {
+		t.Errorf("Versions = %v, want the versions of the two healthy backends", versions)
+	}
+}
@@ -0,0 +1,175 @@
+package kroki
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorMessageBytes caps RenderError.Message: the message is meant for
+// the model to act on, not to carry a full engine log.
+const maxErrorMessageBytes = 2000
+
+// RenderError is a non-200 response from Kroki, with the diagram engine's
+// message and, where the engine reports one, the position of the offending
+// source line.
+type RenderError struct {
+	StatusCode  int    `json:"status"`
+	DiagramType string `json:"diagramType"`
+	// Message is the engine's error message, stripped of Kroki's
+	// "Error 400:" prefix and of Java stack traces.
+	Message string `json:"message"`
+	// Line and Column are 1-based; zero means the engine did not report it.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+	// Body is the raw response body.
+	Body string `json:"-"`
+	// RetryAfter is the delay the server asked for, if any.
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *RenderError) Error() string {
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("kroki error: %s (line %d, column %d)", e.Message, e.Line, e.Column)
+	case e.Line > 0:
+		return fmt.Sprintf("kroki error: %s (line %d)", e.Message, e.Line)
+	default:
+		return "kroki error: " + e.Message
+	}
+}
+
+// newRenderError builds a RenderError from a failed Kroki response.
+func newRenderError(statusCode int, diagramType string, header http.Header, body []byte, now time.Time) *RenderError {
+	e := &RenderError{
+		StatusCode:  statusCode,
+		DiagramType: diagramType,
+		Body:        string(body),
+		RetryAfter:  parseRetryAfter(header.Get("Retry-After"), now),
+	}
+
+	text := string(body)
+	contentType := header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "image/svg") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("<svg")):
+		// PlantUML reports syntax errors as an image of the error.
+		text = svgText(body)
+	case strings.HasPrefix(contentType, "image/"):
+		text = ""
+	}
+	e.Message = cleanErrorMessage(text)
+	if e.Message == "" {
+		e.Message = fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+	}
+	e.Line, e.Column = locateError(diagramType, e.Message)
+	return e
+}
+
+var (
+	krokiErrorPrefix = regexp.MustCompile(`^Error \d{3}: `)
+	javaStackFrame   = regexp.MustCompile(`^\s+at [\w$.<>]+\(|^\s*\.\.\. \d+ more$`)
+)
+
+// cleanErrorMessage strips Kroki's "Error 400: " prefix and Java stack
+// frames, trims whitespace and caps the length.
+func cleanErrorMessage(text string) string {
+	text = krokiErrorPrefix.ReplaceAllString(strings.TrimSpace(text), "")
+	var kept []string
+	for _, line := range strings.Split(text, "\n") {
+		if javaStackFrame.MatchString(line) {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t\r"))
+	}
+	text = strings.TrimSpace(strings.Join(kept, "\n"))
+	if len(text) > maxErrorMessageBytes {
+		text = strings.ToValidUTF8(text[:maxErrorMessageBytes], "") + "…"
+	}
+	return text
+}
+
+// svgText returns the character data of the <text> elements of an SVG
+// document, one element per line.
+func svgText(body []byte) string {
+	var lines []string
+	d := xml.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	var current strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "text" {
+				depth++
+			}
+		case xml.EndElement:
+			if t.Name.Local == "text" && depth > 0 {
+				depth--
+				if depth == 0 {
+					if line := strings.TrimSpace(current.String()); line != "" {
+						lines = append(lines, line)
+					}
+					current.Reset()
+				}
+			}
+		case xml.CharData:
+			if depth > 0 {
+				current.Write(t)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Engine-specific patterns locating the error in the source. Each has the
+// line in its first group and, when present, the column in its second.
+var (
+	// PlantUML: "Syntax Error? (Assumed diagram type: sequence) (line: 2)"
+	// in text output, "(line 2)" in error images.
+	plantumlLine = regexp.MustCompile(`\(line:? ?(\d+)\)`)
+	// Graphviz: "Error: <stdin>: syntax error in line 3 near '->'".
+	graphvizLine = regexp.MustCompile(`(?i)error in line (\d+)`)
+	// Mermaid: "Parse error on line 2:" or "Lexical error on line 2.".
+	// Its excerpt of the input spans lines, so no column is derived.
+	mermaidLine = regexp.MustCompile(`(?i)error on line (\d+)`)
+	// D2: "failed to compile: /dev/stdin:3:5: unexpected text".
+	d2Position = regexp.MustCompile(`(?m)(?:^|[\s:])(\d+):(\d+): `)
+	// Anything else: "line 3", "line: 3", "line 3, column 5".
+	genericPosition = regexp.MustCompile(`(?i)\bline:? ?(\d+)(?:,? ?col(?:umn)?:? ?(\d+))?`)
+)
+
+// locateError extracts the 1-based line and column from an engine message,
+// returning zeros for what it cannot find.
+func locateError(diagramType, message string) (line, column int) {
+	var patterns []*regexp.Regexp
+	switch diagramType {
+	case "plantuml", "c4plantuml":
+		patterns = []*regexp.Regexp{plantumlLine}
+	case "graphviz", "dot":
+		patterns = []*regexp.Regexp{graphvizLine}
+	case "mermaid":
+		patterns = []*regexp.Regexp{mermaidLine}
+	case "d2":
+		patterns = []*regexp.Regexp{d2Position}
+	}
+	for _, re := range append(patterns, genericPosition) {
+		m := re.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+		line, _ = strconv.Atoi(m[1])
+		if len(m) > 2 && m[2] != "" {
+			column, _ = strconv.Atoi(m[2])
+		}
+		return line, column
+	}
+	return 0, 0
+}
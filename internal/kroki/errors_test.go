@@ -0,0 +1,145 @@
+package kroki
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+func TestNewRenderError_EngineMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		diagramType string
+		contentType string
+		body        string
+		wantMessage string
+		wantLine    int
+		wantColumn  int
+	}{
+		{
+			name:        "plantuml text",
+			diagramType: "plantuml",
+			contentType: "text/plain",
+			body:        "Error 400: Syntax Error? (Assumed diagram type: sequence) (line: 2)",
+			wantMessage: "Syntax Error? (Assumed diagram type: sequence) (line: 2)",
+			wantLine:    2,
+		},
+		{
+			name:        "plantuml error image",
+			diagramType: "plantuml",
+			contentType: "image/svg+xml",
+			body: `<svg xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10"/>` +
+				`<text x="0" y="10">[From string (line 3) ]</text>` +
+				`<text x="0" y="20">A -&gt;</text><text x="0" y="30">Syntax Error?</text></svg>`,
+			wantMessage: "[From string (line 3) ]\nA ->\nSyntax Error?",
+			wantLine:    3,
+		},
+		{
+			name:        "graphviz",
+			diagramType: "graphviz",
+			contentType: "text/plain",
+			body:        "Error 400: Error: <stdin>: syntax error in line 4 near '->'",
+			wantMessage: "Error: <stdin>: syntax error in line 4 near '->'",
+			wantLine:    4,
+		},
+		{
+			name:        "mermaid",
+			diagramType: "mermaid",
+			contentType: "text/plain",
+			body:        "Error 400: Parse error on line 2:\ngraph TD; A-->\n--------------^\nExpecting 'AMP', got 'EOF'",
+			wantMessage: "Parse error on line 2:\ngraph TD; A-->\n--------------^\nExpecting 'AMP', got 'EOF'",
+			wantLine:    2,
+		},
+		{
+			name:        "d2",
+			diagramType: "d2",
+			contentType: "text/plain",
+			body:        "Error 400: failed to compile: /dev/stdin:3:5: unexpected text after map key",
+			wantMessage: "failed to compile: /dev/stdin:3:5: unexpected text after map key",
+			wantLine:    3,
+			wantColumn:  5,
+		},
+		{
+			name:        "java stack trace dropped",
+			diagramType: "bpmn",
+			contentType: "text/plain",
+			body:        "Error 400: invalid BPMN at line 7, column 12\n\tat io.kroki.server.Bpmn.convert(Bpmn.java:42)\n\tat io.vertx.core.Handler.handle(Handler.java:1)\n\t... 12 more",
+			wantMessage: "invalid BPMN at line 7, column 12",
+			wantLine:    7,
+			wantColumn:  12,
+		},
+		{
+			name:        "raster error image",
+			diagramType: "plantuml",
+			contentType: "image/png",
+			body:        "\x89PNG\r\n\x1a\n",
+			wantMessage: "400 Bad Request",
+		},
+		{
+			name:        "no position",
+			diagramType: "svgbob",
+			contentType: "text/plain",
+			body:        "Error 400: unsupported option",
+			wantMessage: "unsupported option",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Content-Type": {tt.contentType}}
+			e := newRenderError(http.StatusBadRequest, tt.diagramType, header, []byte(tt.body), time.Now())
+			if e.StatusCode != http.StatusBadRequest || e.DiagramType != tt.diagramType {
+				t.Errorf("status/type = %d/%q, want 400/%q", e.StatusCode, e.DiagramType, tt.diagramType)
+			}
+			if e.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", e.Message, tt.wantMessage)
+			}
+			if e.Line != tt.wantLine || e.Column != tt.wantColumn {
+				t.Errorf("position = %d:%d, want %d:%d", e.Line, e.Column, tt.wantLine, tt.wantColumn)
+			}
+			if e.Body != tt.body {
+				t.Errorf("Body not preserved")
+			}
+		})
+	}
+}
+
+func TestRenderError_Error(t *testing.T) {
+	e := &RenderError{Message: "syntax error", Line: 3, Column: 5}
+	if got, want := e.Error(), "kroki error: syntax error (line 3, column 5)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	e.Column = 0
+	if got, want := e.Error(), "kroki error: syntax error (line 3)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestCleanErrorMessage_CapsLength(t *testing.T) {
+	got := cleanErrorMessage(strings.Repeat("x", 3*maxErrorMessageBytes))
+	if len(got) > maxErrorMessageBytes+len("…") {
+		t.Errorf("message length = %d, want at most %d", len(got), maxErrorMessageBytes)
+	}
+}
+
+func TestRenderDiagram_ReturnsRenderError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Error 400: Error: <stdin>: syntax error in line 1 near '}'"))
+	}))
+	t.Cleanup(ts.Close)
+
+	kc := newTestClient(t, ts.URL)
+	_, err := kc.RenderDiagram("graphviz", "digraph {", model.SVG, nil)
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("err = %v, want *RenderError", err)
+	}
+	if renderErr.DiagramType != "graphviz" || renderErr.Line != 1 {
+		t.Errorf("RenderError = %+v, want graphviz error on line 1", renderErr)
+	}
+}
@@ -0,0 +1,153 @@
+package kroki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendHealth is the outcome of probing a backend's /health endpoint.
+type BackendHealth struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	// LatencyMillis is how long the backend took to answer.
+	LatencyMillis int64  `json:"latencyMs"`
+	Error         string `json:"error,omitempty"`
+	// Versions lists the versions the backend reported for itself (under
+	// "kroki") and for the diagram engines it renders with, keyed by the
+	// engine name Kroki uses, e.g. "mermaid". Engines a backend reports as
+	// failing are left out.
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+// CheckHealth probes the /health endpoint of every backend concurrently and
+// reports each one in the order of Backends. A backend is healthy when it
+// answers 200 before ctx ends. Probes bypass retries and leave the circuit
+// breakers alone: they report on the backends without steering renders.
+func (kc *KrokiClient) CheckHealth(ctx context.Context) []BackendHealth {
+	backends := kc.allBackends()
+	results := make([]BackendHealth, len(backends))
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Go(func() {
+			start := time.Now()
+			versions, err := kc.probe(ctx, b.URL)
+			results[i] = BackendHealth{
+				URL:           b.URL,
+				Healthy:       err == nil,
+				LatencyMillis: time.Since(start).Milliseconds(),
+				Versions:      versions,
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// probe sends GET /health to the Kroki server at host and returns the
+// versions its response lists.
+func (kc *KrokiClient) probe(ctx context.Context, host string) (map[string]string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	u = u.JoinPath("health")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := kc.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return parseHealthVersions(body), nil
+}
+
+// parseHealthVersions reads the versions out of a Kroki /health response,
+// which follows the health check response format for HTTP APIs: "version"
+// holds the server version, as a string or as an object with a "number"
+// (or a "kroki" entry), and Kroki releases that report their diagram
+// engines list them in that object, each as a string or an object with a
+// "number". Checks in the
+// "checks" object, keyed "engine" or "engine:measurement", contribute their
+// observedValue unless their status is "fail". Anything else is ignored, so
+// a response without engine details yields at most the server version.
+func parseHealthVersions(body []byte) map[string]string {
+	var response struct {
+		Version json.RawMessage              `json:"version"`
+		Checks  map[string][]json.RawMessage `json:"checks"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
+	}
+	versions := map[string]string{}
+	var server string
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(response.Version, &server) == nil && server != "" {
+		versions["kroki"] = server
+	} else if json.Unmarshal(response.Version, &fields) == nil {
+		for name, raw := range fields {
+			switch name {
+			case "number":
+				name = "kroki"
+			case "major", "minor", "patch", "build_hash":
+				continue
+			}
+			if v, ok := versionString(raw); ok {
+				versions[name] = v
+			}
+		}
+	}
+	for key, checks := range response.Checks {
+		name, _, _ := strings.Cut(key, ":")
+		for _, raw := range checks {
+			var check struct {
+				Status        string `json:"status"`
+				ObservedValue any    `json:"observedValue"`
+			}
+			if json.Unmarshal(raw, &check) != nil || check.Status == "fail" {
+				continue
+			}
+			if v, ok := check.ObservedValue.(string); ok && v != "" {
+				versions[name] = v
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions
+}
+
+// versionString returns a version given as a JSON string or as an object
+// with a "number" string.
+func versionString(raw json.RawMessage) (string, bool) {
+	var v string
+	if json.Unmarshal(raw, &v) == nil {
+		return v, v != ""
+	}
+	var object struct {
+		Number string `json:"number"`
+	}
+	if json.Unmarshal(raw, &object) == nil {
+		return object.Number, object.Number != ""
+	}
+	return "", false
+}
@@ -0,0 +1,85 @@
+package kroki
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckHealth(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/health" {
+			t.Errorf("probe = %s %s, want GET /health", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"status":"pass"}`))
+	}))
+	t.Cleanup(healthy.Close)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	kc := newTestClient(t, healthy.URL, WithBackends(Backend{URL: failing.URL}, Backend{URL: slow.URL, Fallback: true}))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	got := kc.CheckHealth(ctx)
+
+	if len(got) != 3 {
+		t.Fatalf("CheckHealth returned %d results, want 3", len(got))
+	}
+	for i, want := range []struct {
+		url     string
+		healthy bool
+	}{{healthy.URL, true}, {failing.URL, false}, {slow.URL, false}} {
+		if got[i].URL != want.url || got[i].Healthy != want.healthy {
+			t.Errorf("result %d = %+v, want %s healthy=%v", i, got[i], want.url, want.healthy)
+		}
+		if !want.healthy && got[i].Error == "" {
+			t.Errorf("result %d has no error", i)
+		}
+	}
+}
+
+func TestParseHealthVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{name: "status only", body: `{"status":"pass"}`},
+		{name: "not JSON", body: `OK`},
+		{name: "version string", body: `{"status":"pass","version":"0.28.0"}`, want: map[string]string{"kroki": "0.28.0"}},
+		{
+			name: "version object",
+			body: `{"status":"pass","version":{"number":"0.28.0","major":0,"minor":28,"patch":0,"build_hash":"abc123"}}`,
+			want: map[string]string{"kroki": "0.28.0"},
+		},
+		{
+			name: "engine versions",
+			body: `{"status":"pass","version":{"kroki":{"number":"0.28.0","build_hash":"abc123"},"plantuml":"1.2025.4","mermaid":"11.4.1","bpmn":"unknown"}}`,
+			want: map[string]string{"kroki": "0.28.0", "plantuml": "1.2025.4", "mermaid": "11.4.1", "bpmn": "unknown"},
+		},
+		{
+			name: "checks",
+			body: `{"status":"warn","version":"0.28.0","checks":{"mermaid:version":[{"status":"pass","observedValue":"11.4.1"}],"excalidraw:version":[{"status":"fail","observedValue":"0.18.0"}],"uptime":[{"status":"pass","observedValue":1234}]}}`,
+			want: map[string]string{"kroki": "0.28.0", "mermaid": "11.4.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseHealthVersions([]byte(tt.body)); !maps.Equal(got, tt.want) {
+				t.Errorf("parseHealthVersions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
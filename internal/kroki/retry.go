@@ -0,0 +1,110 @@
+package kroki
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how failed Kroki renders are retried. The zero
+// value makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// InitialBackoff is the upper bound of the jittered delay before the
+	// first retry; it doubles on every further retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, including delays the
+	// server asks for with Retry-After.
+	MaxBackoff time.Duration
+}
+
+// WithRetry retries renders that failed with a network error or a 429/5xx
+// response, waiting with exponential backoff and full jitter in between.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *clientOptions) { o.retry = policy }
+}
+
+// retryable reports whether err is worth another attempt: a transport error
+// (including the client's own request timeout) or a status that signals an
+// overloaded or unhealthy server, but not a 4xx for a broken diagram source.
+// Requests aborted by the caller's context are filtered out before this is
+// consulted, since an http.Client timeout also matches
+// context.DeadlineExceeded.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isCircuitOpen(err) {
+		return false
+	}
+	var re *RenderError
+	if errors.As(err, &re) {
+		return re.StatusCode == http.StatusTooManyRequests || re.StatusCode >= 500
+	}
+	return true
+}
+
+func isCircuitOpen(err error) bool {
+	var circuitErr *CircuitOpenError
+	return errors.As(err, &circuitErr)
+}
+
+// backoff returns the delay before retry number n (1-based) after err:
+// the server's Retry-After when it sent one, otherwise a random duration in
+// [0, InitialBackoff*2^(n-1)]. Both are capped at MaxBackoff.
+func (p RetryPolicy) backoff(n int, err error) time.Duration {
+	var d time.Duration
+	var re *RenderError
+	if errors.As(err, &re) && re.RetryAfter > 0 {
+		d = re.RetryAfter
+	} else if p.InitialBackoff > 0 {
+		ceiling := p.InitialBackoff << min(n-1, 30)
+		if ceiling <= 0 || (p.MaxBackoff > 0 && ceiling > p.MaxBackoff) {
+			ceiling = p.MaxBackoff
+		}
+		d = rand.N(ceiling + 1)
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay seconds
+// or as an HTTP date. Missing or malformed values yield 0.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,173 @@
+package kroki
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// newFlakyKrokiHost answers the first failures requests with status and
+// every later one with fake image bytes, counting the requests it received.
+func newFlakyKrokiHost(t *testing.T, failures int32, status int, header http.Header) (string, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			w.Write([]byte("backend unavailable"))
+			return
+		}
+		w.Write([]byte("fake-image-bytes"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, &hits
+}
+
+func TestRenderDiagram_RetriesServerErrors(t *testing.T) {
+	host, hits := newFlakyKrokiHost(t, 2, http.StatusServiceUnavailable, nil)
+	client := newTestClient(t, host, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	result, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil)
+	if err != nil {
+		t.Fatalf("RenderDiagram: %v", err)
+	}
+	if string(result.ImageContent) != "fake-image-bytes" {
+		t.Errorf("unexpected image content: %s", string(result.ImageContent))
+	}
+	if got := hits.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+func TestRenderDiagram_GivesUpAfterMaxAttempts(t *testing.T) {
+	host, hits := newFlakyKrokiHost(t, 10, http.StatusBadGateway, nil)
+	client := newTestClient(t, host, WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+
+	if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestRenderDiagram_DoesNotRetryClientErrors(t *testing.T) {
+	host, hits := newFlakyKrokiHost(t, 10, http.StatusBadRequest, nil)
+	client := newTestClient(t, host, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err == nil {
+		t.Fatal("expected an error for a 400 response")
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestRenderDiagram_HonorsRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"1"}}
+	host, _ := newFlakyKrokiHost(t, 1, http.StatusTooManyRequests, header)
+	client := newTestClient(t, host, WithRetry(RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+	}))
+
+	start := time.Now()
+	if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err != nil {
+		t.Fatalf("RenderDiagram: %v", err)
+	}
+	// Retry-After asks for 1s, which MaxBackoff caps at 100ms.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("elapsed = %s, want about 100ms", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "", want: 0},
+		{in: "7", want: 7 * time.Second},
+		{in: "-1", want: 0},
+		{in: "soon", want: 0},
+		{in: now.Add(30 * time.Second).Format(http.TimeFormat), want: 30 * time.Second},
+		{in: now.Add(-30 * time.Second).Format(http.TimeFormat), want: 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreaker_OpensAndFailsFast(t *testing.T) {
+	host, hits := newFlakyKrokiHost(t, 100, http.StatusServiceUnavailable, nil)
+	client := newTestClient(t, host, WithCircuitBreaker(CircuitBreakerSettings{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+	}))
+
+	for range 2 {
+		if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err == nil {
+			t.Fatal("expected an error from the failing host")
+		}
+	}
+	_, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("error = %v, want *CircuitOpenError", err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2 (the open circuit must not reach the host)", got)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenTrial(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker("http://kroki", CircuitBreakerSettings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	b.now = func() time.Time { return now }
+	unavailable := &RenderError{StatusCode: http.StatusServiceUnavailable}
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("closed breaker rejected a request: %v", err)
+	}
+	b.record(unavailable)
+	if err := b.allow(); err == nil {
+		t.Fatal("open breaker admitted a request")
+	}
+
+	// After OpenTimeout exactly one trial request is admitted.
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("half-open breaker rejected the trial request: %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Fatal("half-open breaker admitted a second concurrent request")
+	}
+
+	// A failed trial re-opens the circuit; a successful one closes it.
+	b.record(unavailable)
+	if err := b.allow(); err == nil {
+		t.Fatal("breaker admitted a request right after a failed trial")
+	}
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("half-open breaker rejected the trial request: %v", err)
+	}
+	b.record(nil)
+	for range 3 {
+		if err := b.allow(); err != nil {
+			t.Fatalf("closed breaker rejected a request: %v", err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package kroki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Option configures a KrokiClient built by NewKrokiClient.
+type Option func(*clientOptions)
+
+// clientOptions collects the settings Options apply. The HTTP client is only
+// built once all options are known, so file-based settings (CA bundle,
+// client certificate) are loaded and validated in one place.
+type clientOptions struct {
+	httpClient         *http.Client
+	timeout            time.Duration
+	dialTimeout        time.Duration
+	idleConnTimeout    time.Duration
+	proxyURL           string
+	caFile             string
+	certFile           string
+	keyFile            string
+	insecureSkipVerify bool
+	retry              RetryPolicy
+	breaker            CircuitBreakerSettings
+	backends           []Backend
+	observe            RequestObserver
+}
+
+// WithHTTPClient makes the client use c as-is. It takes precedence over every
+// transport option below, which is mostly useful in tests.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *clientOptions) { o.httpClient = c }
+}
+
+// WithTimeout bounds a whole Kroki request, including reading the response
+// body. Zero means no limit beyond the caller's context.
+func WithTimeout(d time.Duration) Option {
+	return func(o *clientOptions) { o.timeout = d }
+}
+
+// WithDialTimeout bounds establishing the TCP connection to Kroki.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *clientOptions) { o.dialTimeout = d }
+}
+
+// WithIdleConnTimeout sets how long an idle keep-alive connection to Kroki
+// stays in the pool.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(o *clientOptions) { o.idleConnTimeout = d }
+}
+
+// WithProxy routes Kroki requests through the proxy at rawURL. Without it the
+// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+func WithProxy(rawURL string) Option {
+	return func(o *clientOptions) { o.proxyURL = rawURL }
+}
+
+// WithCAFile trusts the PEM certificates in path in addition to the system
+// roots, e.g. an internal CA signing a self-hosted Kroki or a TLS-inspecting
+// proxy.
+func WithCAFile(path string) Option {
+	return func(o *clientOptions) { o.caFile = path }
+}
+
+// WithClientCertificate presents the PEM certificate and key as a TLS client
+// certificate (mTLS). Both files are required.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(o *clientOptions) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithInsecureSkipVerify disables verification of Kroki's TLS certificate.
+// It is meant for development against self-signed hosts only.
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(o *clientOptions) { o.insecureSkipVerify = skip }
+}
+
+// newHTTPClient builds the *http.Client described by o, starting from the
+// defaults of http.DefaultTransport.
+func newHTTPClient(o *clientOptions) (*http.Client, error) {
+	if o.httpClient != nil {
+		return o.httpClient, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.dialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   o.dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if o.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = o.idleConnTimeout
+	}
+	if o.proxyURL != "" {
+		proxy, err := url.Parse(o.proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", o.proxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := newTLSConfig(o)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   o.timeout,
+	}, nil
+}
+
+// newTLSConfig loads the CA bundle and client certificate named in o.
+func newTLSConfig(o *clientOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- opt-in for development, documented as such.
+		InsecureSkipVerify: o.insecureSkipVerify,
+	}
+
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %q contains no PEM certificates", o.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.certFile != "" || o.keyFile != "" {
+		if o.certFile == "" || o.keyFile == "" {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
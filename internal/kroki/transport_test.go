@@ -0,0 +1,100 @@
+package kroki
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// writeServerCA writes the certificate of a TLS test server to a PEM file so
+// it can be passed to WithCAFile.
+func writeServerCA(t *testing.T, ts *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+	return path
+}
+
+func TestNewKrokiClient_CAFileTrustsServer(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fake-image-bytes"))
+	}))
+	defer ts.Close()
+
+	// Without the CA the self-signed certificate is rejected.
+	untrusted := newTestClient(t, ts.URL)
+	if _, err := untrusted.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err == nil {
+		t.Fatal("expected a certificate error without the CA bundle")
+	}
+
+	trusted := newTestClient(t, ts.URL, WithCAFile(writeServerCA(t, ts)))
+	result, err := trusted.RenderDiagram("plantuml", "A -> B", model.SVG, nil)
+	if err != nil {
+		t.Fatalf("RenderDiagram with CA bundle: %v", err)
+	}
+	if string(result.ImageContent) != "fake-image-bytes" {
+		t.Errorf("unexpected image content: %s", string(result.ImageContent))
+	}
+}
+
+func TestNewKrokiClient_InsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fake-image-bytes"))
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL, WithInsecureSkipVerify(true))
+	if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err != nil {
+		t.Fatalf("RenderDiagram: %v", err)
+	}
+}
+
+func TestNewKrokiClient_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	client := newTestClient(t, ts.URL, WithTimeout(50*time.Millisecond))
+	if _, err := client.RenderDiagram("plantuml", "A -> B", model.SVG, nil); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+}
+
+func TestNewKrokiClient_InvalidOptions(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opt     Option
+		wantErr string
+	}{
+		{name: "missing CA file", opt: WithCAFile(filepath.Join(t.TempDir(), "missing.pem")), wantErr: "read CA bundle"},
+		{name: "CA file without certificates", opt: WithCAFile(notPEM), wantErr: "contains no PEM certificates"},
+		{name: "client cert without key", opt: WithClientCertificate("cert.pem", ""), wantErr: "must be set together"},
+		{name: "invalid proxy URL", opt: WithProxy("http://proxy:port"), wantErr: "invalid proxy URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKrokiClient("https://kroki.io", tt.opt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewKrokiClient error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// isAutoDiagramType reports whether a diagramType argument asks for the type
+// to be detected from the source.
+func isAutoDiagramType(diagramType string) bool {
+	return diagramType == "" || strings.EqualFold(diagramType, model.AutoDiagramType)
+}
+
+// withDetectedType tells the client what the diagram type of its source
+// looks like. A detected type is noted in the result, and a declared type
+// that disagrees with the source gets a warning, even when the call failed:
+// a mislabelled source is a common cause of Kroki syntax errors.
+func (s *KrokiMCPServer) withDetectedType(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, req)
+		args := req.GetArguments()
+		if _, ok := args["source"]; result == nil || !ok {
+			return result, err
+		}
+		if note := detectionNote(req.GetString("diagramType", ""), req.GetString("source", "")); note != "" {
+			result.Content = append(result.Content, mcp.NewTextContent(note))
+		}
+		return result, err
+	}
+}
+
+// detectionNote returns the note or warning to add to a result for the
+// declared diagram type and the source, or "" when there is nothing to say.
+func detectionNote(declared, source string) string {
+	detected := model.DetectDiagramType(source)
+	if detected == "" {
+		return ""
+	}
+	if isAutoDiagramType(declared) {
+		return fmt.Sprintf("Note: diagramType %s was detected from the source.", detected)
+	}
+	name := declared
+	if diagram, ok := model.Diagrams.Lookup(declared); ok {
+		name = diagram.Name
+	}
+	if name == detected || (plantumlFamily(name) && plantumlFamily(detected)) {
+		return ""
+	}
+	slog.Warn("Declared diagram type disagrees with the source", "diagramType", name, "detected", detected)
+	return fmt.Sprintf("Warning: diagramType is %s but the source looks like %s; if the diagram is wrong or failed to render, retry with diagramType %s.", name, detected, detected)
+}
+
+// plantumlFamily reports whether diagramType is rendered by PlantUML, which
+// also renders C4 sources labelled plantuml.
+func plantumlFamily(diagramType string) bool {
+	return diagramType == "plantuml" || diagramType == "c4plantuml"
+}
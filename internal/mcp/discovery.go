@@ -0,0 +1,71 @@
+package mcp
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// discoveryTimeout bounds one round of probing the backends' /health
+// endpoints.
+const discoveryTimeout = 10 * time.Second
+
+// DiscoverDiagramTypes asks the Kroki backends which diagram types they
+// render and limits the tools and diagrams://types to those, notifying
+// clients when the tools change. When no backend answers, the types found
+// last, or every type before the first discovery, stay in place.
+func (s *KrokiMCPServer) DiscoverDiagramTypes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	d, err := s.KrokiClient().DiscoverDiagramTypes(ctx)
+	if err != nil {
+		return err
+	}
+	previous := s.discovery.Swap(d)
+	if previous == nil || !slices.Equal(previous.DiagramTypes, d.DiagramTypes) {
+		var unavailable []string
+		for _, name := range model.Diagrams.Names() {
+			if !slices.Contains(d.DiagramTypes, name) {
+				unavailable = append(unavailable, name)
+			}
+		}
+		slog.Info("Discovered the diagram types of the Kroki backends", "available", len(d.DiagramTypes), "unavailable", unavailable)
+	}
+	s.updateTools()
+	return nil
+}
+
+// WatchDiagramTypes runs DiscoverDiagramTypes now and then every interval
+// until ctx ends.
+func (s *KrokiMCPServer) WatchDiagramTypes(ctx context.Context, interval time.Duration) {
+	for {
+		if err := s.DiscoverDiagramTypes(ctx); err != nil {
+			slog.Warn("Diagram type discovery failed, keeping the current types", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// EngineVersions returns the versions each Kroki backend reported for
+// itself and its diagram engines in the latest discovery, keyed by backend
+// URL, or nil before one succeeded.
+func (s *KrokiMCPServer) EngineVersions() map[string]map[string]string {
+	if d := s.discovery.Load(); d != nil {
+		return d.Versions()
+	}
+	return nil
+}
+
+// available reports whether the latest discovery found a backend rendering
+// diagramType; before one succeeded, every type counts as available.
+func (s *KrokiMCPServer) available(diagramType string) bool {
+	d := s.discovery.Load()
+	return d == nil || slices.Contains(d.DiagramTypes, diagramType)
+}
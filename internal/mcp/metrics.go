@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/utain/kroki-mcp/internal/metrics"
+	"github.com/utain/kroki-mcp/internal/model"
+)
+
+// invalidLabel replaces argument values outside the supported lists in
+// metric labels, so arbitrary client input cannot grow the label set.
+const invalidLabel = "invalid"
+
+// WithMetrics records tool calls, render cache lookups, local SVG
+// conversions and client sessions in m. Kroki requests are recorded by the
+// client itself; see kroki.WithRequestObserver.
+func WithMetrics(m *metrics.Metrics) ServerOption {
+	return func(s *KrokiMCPServer) { s.metrics = m }
+}
+
+// sessionHooks keeps the active sessions gauge current.
+func (s *KrokiMCPServer) sessionHooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(func(context.Context, server.ClientSession) { s.metrics.SessionOpened() })
+	hooks.AddOnUnregisterSession(func(context.Context, server.ClientSession) { s.metrics.SessionClosed() })
+	return hooks
+}
+
+// withMetrics records every tool call's latency, outcome and response size,
+// labelled with the diagram type and the output format it resolved to.
+func (s *KrokiMCPServer) withMetrics(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, req)
+		failed := err != nil || result == nil || result.IsError
+		bytes := 0
+		if !failed {
+			bytes = resultBytes(result)
+		}
+		s.metrics.ToolCall(req.Params.Name, diagramTypeLabel(req), s.formatLabel(req), failed, time.Since(start), bytes)
+		return result, err
+	}
+}
+
+func diagramTypeLabel(req mcp.CallToolRequest) string {
+	diagramType := req.GetString("diagramType", "")
+	if isAutoDiagramType(diagramType) {
+		diagramType = model.DetectDiagramType(req.GetString("source", ""))
+	}
+	diagram, ok := model.Diagrams.Lookup(diagramType)
+	if !ok {
+		return invalidLabel
+	}
+	return diagram.Name
+}
+
+// formatLabel returns the output format a call produces, applying the same
+// defaults as the tools themselves.
+func (s *KrokiMCPServer) formatLabel(req mcp.CallToolRequest) string {
+	var format string
+	switch req.Params.Name {
+	case "generate_diagram":
+		format = req.GetString("format", s.defaultFormat(model.SVG))
+	case "get_diagram_url":
+		format = req.GetString("format", s.defaultURLFormat())
+	case "generate_png_diagram_with_custom_dpi":
+		return string(model.PNG)
+	case "validate_diagram":
+		return string(validationFormat)
+	}
+	format = strings.ToLower(format)
+	if !slices.Contains(model.SupportedOutputFormats, format) {
+		return invalidLabel
+	}
+	return format
+}
+
+// resultBytes is the size of what a tool returned: decoded image and blob
+// resource bytes plus the length of text blocks.
+func resultBytes(result *mcp.CallToolResult) int {
+	n := 0
+	for _, content := range result.Content {
+		switch c := content.(type) {
+		case mcp.ImageContent:
+			n += base64Len(c.Data)
+		case mcp.TextContent:
+			n += len(c.Text)
+		case mcp.EmbeddedResource:
+			if blob, ok := c.Resource.(mcp.BlobResourceContents); ok {
+				n += base64Len(blob.Blob)
+			}
+		}
+	}
+	return n
+}
+
+// base64Len returns the length of the data base64 encodes.
+func base64Len(data string) int {
+	return len(data)/4*3 - strings.Count(data[max(len(data)-2, 0):], "=")
+}
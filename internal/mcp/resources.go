@@ -3,8 +3,12 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	"github.com/utain/kroki-mcp/internal/model"
 )
 
@@ -12,11 +16,11 @@ func (s *KrokiMCPServer) RegisterDiagramTypesResource() {
 	resource := mcp.NewResource(
 		"diagrams://types",
 		"Supported Diagram Types",
-		mcp.WithResourceDescription("List of supported diagram types"),
+		mcp.WithResourceDescription("List of the diagram types this server accepts and its Kroki backends render; diagrams://types/{name} describes each"),
 		mcp.WithMIMEType("application/json"),
 	)
 	s.mcp.AddResource(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
-		data, err := json.Marshal(model.SupportedDiagramTypes)
+		data, err := json.Marshal(s.diagramTypes())
 		if err != nil {
 			return nil, err
 		}
@@ -30,6 +34,46 @@ func (s *KrokiMCPServer) RegisterDiagramTypesResource() {
 	})
 }
 
+// RegisterDiagramTypeResource serves the registry entry of each accepted
+// diagram type: its aliases, the formats Kroki renders it to, file
+// extensions, diagram options, documentation URL and an example source,
+// plus the engine version the Kroki backends reported.
+func (s *KrokiMCPServer) RegisterDiagramTypeResource() {
+	template := mcp.NewResourceTemplate(
+		"diagrams://types/{name}",
+		"Diagram Type",
+		mcp.WithTemplateDescription("Output formats, aliases, file extensions, diagram options, documentation URL and an example source of a diagram type"),
+		mcp.WithTemplateMIMEType("application/json"),
+	)
+	s.mcp.AddResourceTemplate(template, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		name := strings.TrimPrefix(request.Params.URI, "diagrams://types/")
+		diagram, ok := model.Diagrams.Lookup(name)
+		if !ok || !slices.Contains(s.diagramTypes(), diagram.Name) {
+			return nil, fmt.Errorf("diagram type %q: %w", name, server.ErrResourceNotFound)
+		}
+		entry := struct {
+			model.DiagramType
+			// EngineVersion is the version a backend reported for the
+			// type's engine in the latest discovery.
+			EngineVersion string `json:"engineVersion,omitempty"`
+		}{DiagramType: diagram}
+		if d := s.discovery.Load(); d != nil {
+			entry.EngineVersion = d.EngineVersion(diagram.Name)
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(data),
+			},
+		}, nil
+	})
+}
+
 func (s *KrokiMCPServer) RegisterOutputFormatsResource() {
 	resource := mcp.NewResource(
 		"diagrams://formats",
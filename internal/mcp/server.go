@@ -1,16 +1,25 @@
 package mcp
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/utain/kroki-mcp/internal/cache"
 	"github.com/utain/kroki-mcp/internal/config"
 	"github.com/utain/kroki-mcp/internal/kroki"
+	"github.com/utain/kroki-mcp/internal/metrics"
+	"github.com/utain/kroki-mcp/internal/telemetry"
 )
 
 type DiagramRequest struct {
-	DiagramType string  `json:"diagramType"`
-	Source      string  `json:"source"`
-	Format      string  `json:"format"`
-	Quality     float64 `json:"quality"`
+	DiagramType string `json:"diagramType"`
+	Source      string `json:"source"`
+	Format      string `json:"format"`
 }
 
 type DiagramResponse struct {
@@ -18,23 +27,79 @@ type DiagramResponse struct {
 	URL          string `json:"url"`
 }
 type KrokiMCPServer struct {
-	mcp         *server.MCPServer
-	krokiClient *kroki.KrokiClient
-	cfg         *config.Config
+	mcp     *server.MCPServer
+	cache   cache.Cache
+	metrics *metrics.Metrics
+
+	// krokiClient and cfg are swapped by SetKrokiClient and UpdateConfig on
+	// a configuration reload; each tool call works with the ones current
+	// when it reads them.
+	krokiClient atomic.Pointer[kroki.KrokiClient]
+	cfg         atomic.Pointer[config.Config]
+	// discovery is the latest result of DiscoverDiagramTypes, nil until one
+	// succeeds.
+	discovery atomic.Pointer[kroki.Discovery]
+
+	// toolsMu serializes the comparison and swap of the tools.
+	toolsMu sync.Mutex
+
+	// ctx is the parent of every tool call's context. Close cancels it so
+	// in-flight Kroki requests abort when the server shuts down.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards draining and the Add side of inflight, so no call starts
+	// once Drain has begun waiting.
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
 }
 
-func NewKrokiMCPServer(cfg *config.Config, krokiClient *kroki.KrokiClient) *KrokiMCPServer {
-	server := server.NewMCPServer(
-		"Kroki MCP Server",
-		"2.0.0",
-	)
+// ServerOption configures optional KrokiMCPServer features.
+type ServerOption func(*KrokiMCPServer)
+
+// WithRenderCache serves repeated renders from c instead of calling Kroki
+// again.
+func WithRenderCache(c cache.Cache) ServerOption {
+	return func(s *KrokiMCPServer) { s.cache = c }
+}
 
-	return &KrokiMCPServer{mcp: server, cfg: cfg, krokiClient: krokiClient}
+func NewKrokiMCPServer(cfg *config.Config, krokiClient *kroki.KrokiClient, opts ...ServerOption) *KrokiMCPServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &KrokiMCPServer{ctx: ctx, cancel: cancel}
+	s.cfg.Store(cfg)
+	s.krokiClient.Store(krokiClient)
+	for _, opt := range opts {
+		opt(s)
+	}
+	// Tool spans follow the global tracer provider, so they cost next to
+	// nothing until telemetry.Setup enables tracing. Trace context comes from
+	// the request's _meta, or the HTTP headers in the network modes.
+	serverOpts := []server.ServerOption{
+		server.WithTracer(telemetry.MCPTracer()),
+		server.WithPropagator(telemetry.MCPPropagator()),
+		server.WithMetaPropagator(telemetry.MCPMetaPropagator()),
+	}
+	if s.metrics != nil {
+		// Ahead of withServerContext, so calls turned away while draining
+		// are counted too.
+		serverOpts = append(serverOpts,
+			server.WithToolHandlerMiddleware(s.withMetrics),
+			server.WithHooks(s.sessionHooks()),
+		)
+	}
+	serverOpts = append(serverOpts,
+		server.WithToolHandlerMiddleware(s.withServerContext),
+		server.WithToolHandlerMiddleware(s.withDetectedType),
+	)
+	s.mcp = server.NewMCPServer("Kroki MCP Server", "2.0.0", serverOpts...)
+	return s
 }
 
 func (s *KrokiMCPServer) Handler() *server.MCPServer {
 	// Register the diagram types and output formats resources
 	s.RegisterDiagramTypesResource()
+	s.RegisterDiagramTypeResource()
 	s.RegisterOutputFormatsResource()
 	s.RegisterRecommendedDPIList()
 
@@ -42,5 +107,120 @@ func (s *KrokiMCPServer) Handler() *server.MCPServer {
 	s.RegisterGenerateDiagramTool()
 	s.RegisterGeneratePNGDiagramWithCustomDPITool()
 	s.RegisterGetDiagramURLTool()
+	s.RegisterValidateDiagramTool()
 	return s.mcp
 }
+
+// tools returns the tools as the current configuration defines them.
+func (s *KrokiMCPServer) tools() []server.ServerTool {
+	return []server.ServerTool{
+		s.generateDiagramTool(),
+		s.generatePNGDiagramWithCustomDPITool(),
+		s.getDiagramURLTool(),
+		s.validateDiagramTool(),
+	}
+}
+
+func (s *KrokiMCPServer) config() *config.Config {
+	return s.cfg.Load()
+}
+
+// KrokiClient returns the Kroki client tool calls currently use.
+func (s *KrokiMCPServer) KrokiClient() *kroki.KrokiClient {
+	return s.krokiClient.Load()
+}
+
+// SetKrokiClient makes tool calls started from now on use kc, e.g. after the
+// Kroki settings were reloaded. Calls in flight finish with the previous
+// client.
+func (s *KrokiMCPServer) SetKrokiClient(kc *kroki.KrokiClient) {
+	s.krokiClient.Store(kc)
+}
+
+// UpdateConfig applies cfg to tool calls started from now on. When it
+// changes the tool definitions, such as the diagram types or default format
+// they advertise, the tools are replaced and the connected clients are sent
+// notifications/tools/list_changed; it reports whether that happened.
+func (s *KrokiMCPServer) UpdateConfig(cfg *config.Config) (toolsChanged bool) {
+	s.cfg.Store(cfg)
+	return s.updateTools()
+}
+
+// updateTools replaces the registered tools when their current definitions
+// differ, reporting whether they did.
+func (s *KrokiMCPServer) updateTools() bool {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+
+	tools := s.tools()
+	registered := s.mcp.ListTools()
+	changed := len(tools) != len(registered)
+	for _, tool := range tools {
+		current, ok := registered[tool.Tool.Name]
+		if !ok || !sameTool(current.Tool, tool.Tool) {
+			changed = true
+		}
+	}
+	if changed {
+		s.mcp.SetTools(tools...)
+	}
+	return changed
+}
+
+// sameTool reports whether a and b are advertised identically.
+func sameTool(a, b mcp.Tool) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// Close cancels every in-flight tool call. Calls made afterwards fail
+// immediately with context.Canceled.
+func (s *KrokiMCPServer) Close() {
+	s.cancel()
+}
+
+// Drain rejects new tool calls and waits for the in-flight ones to finish,
+// returning ctx's error if they are still running when ctx ends. It leaves
+// them running; call Close afterwards to cancel the stragglers.
+func (s *KrokiMCPServer) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withServerContext links each tool call's context to the server lifetime.
+// The call context already ends when the client sends notifications/cancelled,
+// but the SSE transport detaches message handling from the HTTP request, so
+// without this link a server shutdown would leave renders running. It also
+// tracks the call for Drain, turning calls away once draining has begun.
+func (s *KrokiMCPServer) withServerContext(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		s.mu.Lock()
+		if s.draining {
+			s.mu.Unlock()
+			return mcp.NewToolResultError("the server is shutting down; retry the call on another instance"), nil
+		}
+		s.inflight.Add(1)
+		s.mu.Unlock()
+		defer s.inflight.Done()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(s.ctx, cancel)
+		defer stop()
+		return next(ctx, req)
+	}
+}
@@ -5,18 +5,32 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/utain/kroki-mcp/internal/cache"
 	"github.com/utain/kroki-mcp/internal/config"
 	"github.com/utain/kroki-mcp/internal/kroki"
+	"github.com/utain/kroki-mcp/internal/metrics"
+	"github.com/utain/kroki-mcp/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // stubSVG is a minimal but valid SVG document. It is what the stub Kroki
@@ -29,9 +43,10 @@ const stubSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100
 // URL path, so assertions about what the tools forward have to be made
 // against this decoded body.
 type krokiRequestBody struct {
-	DiagramSource string `json:"diagram_source"`
-	DiagramType   string `json:"diagram_type"`
-	OutputFormat  string `json:"output_format"`
+	DiagramSource  string            `json:"diagram_source"`
+	DiagramType    string            `json:"diagram_type"`
+	OutputFormat   string            `json:"output_format"`
+	DiagramOptions map[string]string `json:"diagram_options"`
 }
 
 // stubKrokiRequest is one request observed by the stub Kroki host.
@@ -120,7 +135,10 @@ func newStubKrokiHostServing(t *testing.T, svgBody string) (string, *stubKrokiRe
 func newTestServerWithHost(t *testing.T, host string) *server.MCPServer {
 	t.Helper()
 	cfg := &config.Config{KrokiHost: host}
-	krokiClient := kroki.NewKrokiClient(host)
+	krokiClient, err := kroki.NewKrokiClient(host)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
 	s := NewKrokiMCPServer(cfg, krokiClient)
 	return s.Handler()
 }
@@ -221,7 +239,7 @@ func TestInitialize_AdvertisesToolsAndResources(t *testing.T) {
 	}
 }
 
-// 2. tools/list returns exactly the 3 expected tool names.
+// 2. tools/list returns exactly the 4 expected tool names.
 func TestListTools_ReturnsExpectedNames(t *testing.T) {
 	mcpServer, _ := newTestServer(t)
 	c, _ := newInitializedClient(t, mcpServer)
@@ -237,7 +255,7 @@ func TestListTools_ReturnsExpectedNames(t *testing.T) {
 	}
 	slices.Sort(got)
 
-	want := []string{"generate_diagram", "generate_png_diagram_with_custom_dpi", "get_diagram_url"}
+	want := []string{"generate_diagram", "generate_png_diagram_with_custom_dpi", "get_diagram_url", "validate_diagram"}
 	slices.Sort(want)
 
 	if !slices.Equal(got, want) {
@@ -336,7 +354,7 @@ func TestCallTool_GenerateDiagram_ValidationErrors(t *testing.T) {
 				"source":      "graph TD; A-->B;",
 				"format":      "not-a-format",
 			},
-			wantMsg: "format is required and must be one of: png, svg",
+			wantMsg: "format is required and must be one of: " + strings.Join(model.SupportedOutputFormats, ", "),
 		},
 	}
 
@@ -690,3 +708,1177 @@ func TestCallTool_GenerateDiagram_SVGNormalizedForInline(t *testing.T) {
 		t.Errorf("shape-level colors were modified: %q", svg)
 	}
 }
+
+// 13. Close must abort renders that are in flight: the stub Kroki host blocks
+// until the outgoing request is cancelled, so the tool call only returns if
+// the server context reaches the Kroki client.
+func TestClose_AbortsInFlightRender(t *testing.T) {
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client hanging up once the body
+		// has been consumed.
+		_, _ = io.Copy(io.Discard, r.Body)
+		close(started)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(ts.Close)
+
+	krokiClient, err := kroki.NewKrokiClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s := NewKrokiMCPServer(&config.Config{KrokiHost: ts.URL}, krokiClient)
+	c, _ := newInitializedClient(t, s.Handler())
+	go func() {
+		<-started
+		s.Close()
+	}()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "generate_diagram"
+	req.Params.Arguments = map[string]any{
+		"diagramType": "mermaid",
+		"source":      "graph TD; A-->B;",
+		"format":      "svg",
+	}
+
+	result, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !result.IsError {
+		t.Fatalf("expected IsError result, got success")
+	}
+	if got := firstTextContent(t, result); got != context.Canceled.Error() {
+		t.Errorf("error message = %q, want %q", got, context.Canceled.Error())
+	}
+}
+
+// 14. With a render cache, repeating an identical generate_diagram call is
+// served from the cache: the stub Kroki host sees a single request, and a
+// source differing only in line endings shares the entry. A client pointing
+// at another Kroki server does not reuse the first server's renders.
+func TestCallTool_GenerateDiagram_RenderCache(t *testing.T) {
+	host, recorder := newStubKrokiHost(t)
+	krokiClient, err := kroki.NewKrokiClient(host)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s := NewKrokiMCPServer(&config.Config{KrokiHost: host}, krokiClient, WithRenderCache(cache.NewMemory(8)))
+	c, _ := newInitializedClient(t, s.Handler())
+
+	var first string
+	for i, source := range []string{"graph TD\nA-->B", "graph TD\r\nA-->B\r\n"} {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = map[string]any{
+			"diagramType": "mermaid",
+			"source":      source,
+			"format":      "svg",
+		}
+
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		svg := firstTextContent(t, result)
+		if i == 0 {
+			first = svg
+		} else if svg != first {
+			t.Errorf("cached result = %q, want %q", svg, first)
+		}
+	}
+
+	recorder.only(t)
+
+	otherHost, otherRecorder := newStubKrokiHost(t)
+	otherClient, err := kroki.NewKrokiClient(otherHost)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s.SetKrokiClient(otherClient)
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "generate_diagram"
+	req.Params.Arguments = map[string]any{"diagramType": "mermaid", "source": "graph TD\nA-->B", "format": "svg"}
+	if result, err := c.CallTool(context.Background(), req); err != nil || result.IsError {
+		t.Fatalf("CallTool after SetKrokiClient: %v %+v", err, result)
+	}
+	otherRecorder.only(t)
+}
+
+// 15. Diagram options are validated against the catalog, forwarded to Kroki
+// in the POST body with scalar values stringified, and encoded as query
+// parameters by get_diagram_url.
+func TestCallTool_DiagramOptions(t *testing.T) {
+	t.Run("forwarded in POST body", func(t *testing.T) {
+		host, recorder := newStubKrokiHost(t)
+		mcpServer := newTestServerWithHost(t, host)
+		c, _ := newInitializedClient(t, mcpServer)
+
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = map[string]any{
+			"diagramType": "d2",
+			"source":      "a -> b",
+			"format":      "svg",
+			"options":     map[string]any{"theme": 200, "sketch": true},
+		}
+
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		got := recorder.only(t).Body.DiagramOptions
+		if got["theme"] != "200" || got["sketch"] != "true" || len(got) != 2 {
+			t.Errorf("forwarded diagram_options = %v, want map[sketch:true theme:200]", got)
+		}
+	})
+
+	t.Run("encoded in URL", func(t *testing.T) {
+		mcpServer, _ := newTestServer(t)
+		c, _ := newInitializedClient(t, mcpServer)
+
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "get_diagram_url"
+		req.Params.Arguments = map[string]any{
+			"diagramType": "mermaid",
+			"source":      "graph TD; A-->B;",
+			"format":      "svg",
+			"options":     map[string]any{"theme": "dark"},
+		}
+
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		if text := firstTextContent(t, result); !strings.HasSuffix(text, "?theme=dark") {
+			t.Errorf("URL %q does not carry the theme option", text)
+		}
+	})
+
+	t.Run("rejected before calling Kroki", func(t *testing.T) {
+		mcpServer, _ := newTestServer(t)
+		c, _ := newInitializedClient(t, mcpServer)
+
+		tests := []struct {
+			name    string
+			options any
+			wantMsg string
+		}{
+			{name: "unknown option", options: map[string]any{"layout": "elk"}, wantMsg: `unknown option "layout" for diagram type mermaid`},
+			{name: "disallowed value", options: map[string]any{"theme": "solarized"}, wantMsg: `invalid value "solarized" for option "theme"`},
+			{name: "not an object", options: "theme=dark", wantMsg: "options must be an object mapping option names to values"},
+			{name: "nested value", options: map[string]any{"theme": []any{"dark"}}, wantMsg: `option "theme" must be a string, number or boolean`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := mcp.CallToolRequest{}
+				req.Params.Name = "generate_diagram"
+				req.Params.Arguments = map[string]any{
+					"diagramType": "mermaid",
+					"source":      "graph TD; A-->B;",
+					"format":      "svg",
+					"options":     tt.options,
+				}
+
+				result, err := c.CallTool(context.Background(), req)
+				if err != nil {
+					t.Fatalf("CallTool: %v", err)
+				}
+				if !result.IsError {
+					t.Fatalf("expected IsError result, got success")
+				}
+				if got := firstTextContent(t, result); !strings.Contains(got, tt.wantMsg) {
+					t.Errorf("error message = %q, want it to contain %q", got, tt.wantMsg)
+				}
+			})
+		}
+	})
+}
+
+// 16. A source Kroki rejects comes back as a tool error whose structured
+// content carries the engine's message and the line it points at, not the
+// raw response body.
+func TestCallTool_GenerateDiagram_StructuredRenderError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Error 400: Error: <stdin>: syntax error in line 2 near '->'\n\tat io.kroki.server.Graphviz.convert(Graphviz.java:42)"))
+	}))
+	t.Cleanup(ts.Close)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, ts.URL))
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "generate_diagram"
+	req.Params.Arguments = map[string]any{
+		"diagramType": "graphviz",
+		"source":      "digraph {\n  -> b\n}",
+		"format":      "svg",
+	}
+
+	result, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !result.IsError {
+		t.Fatalf("expected IsError result, got success")
+	}
+	wantText := "kroki error: Error: <stdin>: syntax error in line 2 near '->' (line 2)"
+	if got := firstTextContent(t, result); got != wantText {
+		t.Errorf("error message = %q, want %q", got, wantText)
+	}
+
+	raw, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatalf("marshal structured content: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("unmarshal structured content %s: %v", raw, err)
+	}
+	want := map[string]any{
+		"status":      float64(http.StatusBadRequest),
+		"diagramType": "graphviz",
+		"message":     "Error: <stdin>: syntax error in line 2 near '->'",
+		"line":        float64(2),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("structured content %q = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["column"]; ok {
+		t.Errorf("structured content has a column, Graphviz does not report one: %s", raw)
+	}
+}
+
+// 17. validate_diagram renders to SVG and discards it: a source Kroki
+// accepts reports valid: true, a rejected one reports valid: false with the
+// engine's diagnostics, and neither is a tool error; Kroki failing or
+// rate limiting is.
+func TestCallTool_ValidateDiagram(t *testing.T) {
+	callValidate := func(t *testing.T, host string) *mcp.CallToolResult {
+		t.Helper()
+		c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "validate_diagram"
+		req.Params.Arguments = map[string]any{
+			"diagramType": "Mermaid",
+			"source":      "graph TD; A-->B;",
+		}
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+	structured := func(t *testing.T, result *mcp.CallToolResult) map[string]any {
+		t.Helper()
+		raw, err := json.Marshal(result.StructuredContent)
+		if err != nil {
+			t.Fatalf("marshal structured content: %v", err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatalf("unmarshal structured content %s: %v", raw, err)
+		}
+		return got
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		host, recorder := newStubKrokiHost(t)
+		result := callValidate(t, host)
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		if got := structured(t, result); got["valid"] != true || got["diagnostics"] != nil {
+			t.Errorf("structured content = %v, want valid: true without diagnostics", got)
+		}
+		body := recorder.only(t).Body
+		if body.OutputFormat != "svg" || body.DiagramType != "mermaid" {
+			t.Errorf("Kroki request = %s/%s, want mermaid/svg", body.DiagramType, body.OutputFormat)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Error 400: Parse error on line 1:\ngraph TD; A-->\n--------------^\nExpecting 'AMP', got 'EOF'"))
+		}))
+		t.Cleanup(ts.Close)
+
+		result := callValidate(t, ts.URL)
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		if got := firstTextContent(t, result); !strings.HasPrefix(got, "invalid: Parse error on line 1:") {
+			t.Errorf("text = %q, want an invalid: summary", got)
+		}
+		got := structured(t, result)
+		diagnostics, _ := got["diagnostics"].([]any)
+		if got["valid"] != false || len(diagnostics) != 1 {
+			t.Fatalf("structured content = %v, want valid: false with one diagnostic", got)
+		}
+		if d := diagnostics[0].(map[string]any); d["line"] != float64(1) || d["diagramType"] != "mermaid" {
+			t.Errorf("diagnostic = %v, want mermaid error on line 1", d)
+		}
+	})
+
+	t.Run("Kroki unavailable", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		t.Cleanup(ts.Close)
+
+		if result := callValidate(t, ts.URL); !result.IsError {
+			t.Errorf("expected IsError result when Kroki fails, got success")
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("Too Many Requests"))
+		}))
+		t.Cleanup(ts.Close)
+
+		result := callValidate(t, ts.URL)
+		if !result.IsError {
+			t.Errorf("expected IsError result when Kroki rate limits, got %s", firstTextContent(t, result))
+		}
+		if got := structured(t, result); got["valid"] != nil {
+			t.Errorf("structured content = %v, want the Kroki error rather than a validity verdict", got)
+		}
+	})
+}
+
+// 18. The configured --format is the default for every tool with a format
+// argument: it drives the advertised schema default and is what an omitted
+// format renders to. Without one, each tool keeps its own default.
+func TestCallTool_ConfiguredDefaultFormat(t *testing.T) {
+	newServer := func(t *testing.T, outputFormat string) (*client.Client, *stubKrokiRecorder) {
+		t.Helper()
+		host, recorder := newStubKrokiHost(t)
+		krokiClient, err := kroki.NewKrokiClient(host)
+		if err != nil {
+			t.Fatalf("NewKrokiClient: %v", err)
+		}
+		s := NewKrokiMCPServer(&config.Config{KrokiHost: host, OutputFormat: outputFormat}, krokiClient)
+		c, _ := newInitializedClient(t, s.Handler())
+		return c, recorder
+	}
+	schemaDefaults := func(t *testing.T, c *client.Client) map[string]any {
+		t.Helper()
+		result, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatalf("ListTools: %v", err)
+		}
+		defaults := map[string]any{}
+		for _, tool := range result.Tools {
+			if format, ok := tool.InputSchema.Properties["format"].(map[string]any); ok {
+				defaults[tool.Name] = format["default"]
+			}
+		}
+		return defaults
+	}
+	generate := func(t *testing.T, c *client.Client) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = map[string]any{
+			"diagramType": "mermaid",
+			"source":      "graph TD; A-->B;",
+		}
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		return result
+	}
+
+	t.Run("per-tool defaults", func(t *testing.T) {
+		c, recorder := newServer(t, "")
+		got := schemaDefaults(t, c)
+		if got["generate_diagram"] != "svg" || got["get_diagram_url"] != "png" {
+			t.Errorf("schema defaults = %v, want svg for generate_diagram and png for get_diagram_url", got)
+		}
+		generate(t, c)
+		if format := recorder.only(t).Body.OutputFormat; format != "svg" {
+			t.Errorf("omitted format rendered as %q, want svg", format)
+		}
+	})
+
+	t.Run("configured default", func(t *testing.T) {
+		c, recorder := newServer(t, "png")
+		got := schemaDefaults(t, c)
+		if got["generate_diagram"] != "png" || got["get_diagram_url"] != "png" {
+			t.Errorf("schema defaults = %v, want png for both tools", got)
+		}
+		result := generate(t, c)
+		if format := recorder.only(t).Body.OutputFormat; format != "png" {
+			t.Errorf("omitted format rendered as %q, want png", format)
+		}
+		firstImageContent(t, result)
+	})
+}
+
+// 19. Drain lets in-flight renders finish while turning new tool calls
+// away, and gives up when its context ends.
+func TestDrain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		close(started)
+		<-release
+		w.Write([]byte(stubSVG))
+	}))
+	t.Cleanup(ts.Close)
+
+	krokiClient, err := kroki.NewKrokiClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s := NewKrokiMCPServer(&config.Config{KrokiHost: ts.URL}, krokiClient)
+	c, _ := newInitializedClient(t, s.Handler())
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "generate_diagram"
+	req.Params.Arguments = map[string]any{
+		"diagramType": "mermaid",
+		"source":      "graph TD; A-->B;",
+		"format":      "svg",
+	}
+	inflight := make(chan *mcp.CallToolResult, 1)
+	go func() {
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Errorf("CallTool: %v", err)
+		}
+		inflight <- result
+	}()
+	<-started
+
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Drain(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain with a render in flight = %v, want context.DeadlineExceeded", err)
+	}
+
+	rejected, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CallTool while draining: %v", err)
+	}
+	if !rejected.IsError || !strings.Contains(firstTextContent(t, rejected), "shutting down") {
+		t.Errorf("call while draining was not rejected: %+v", rejected)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- s.Drain(context.Background()) }()
+	close(release)
+	if err := <-drained; err != nil {
+		t.Errorf("Drain: %v", err)
+	}
+	if result := <-inflight; result == nil || result.IsError {
+		t.Errorf("in-flight render did not complete: %+v", result)
+	}
+}
+
+// 20. With metrics, tool calls are counted per tool, diagram type, resolved
+// format and outcome, next to render cache lookups, local conversions, Kroki
+// requests and the connected session.
+func TestMetrics(t *testing.T) {
+	host, _ := newStubKrokiHost(t)
+	m := metrics.New()
+	krokiClient, err := kroki.NewKrokiClient(host, kroki.WithRequestObserver(m.KrokiRequest))
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s := NewKrokiMCPServer(&config.Config{KrokiHost: host}, krokiClient,
+		WithRenderCache(cache.NewMemory(8)), WithMetrics(m))
+	c, _ := newInitializedClient(t, s.Handler())
+
+	calls := []struct {
+		name string
+		args map[string]any
+	}{
+		{"generate_diagram", map[string]any{"diagramType": "Mermaid", "source": "graph TD; A-->B;"}},
+		{"generate_diagram", map[string]any{"diagramType": "mermaid", "source": "graph TD; A-->B;"}},
+		{"generate_diagram", map[string]any{"diagramType": "nope", "source": "x", "format": "gif"}},
+		{"generate_png_diagram_with_custom_dpi", map[string]any{"diagramType": "graphviz", "source": "digraph{a->b}"}},
+	}
+	for _, call := range calls {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = call.name
+		req.Params.Arguments = call.args
+		if _, err := c.CallTool(context.Background(), req); err != nil {
+			t.Fatalf("CallTool %s: %v", call.name, err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := rec.Body.String()
+	for _, want := range []string{
+		`kroki_mcp_tool_calls_total{diagram_type="mermaid",format="svg",outcome="ok",tool="generate_diagram"} 2`,
+		`kroki_mcp_tool_calls_total{diagram_type="invalid",format="invalid",outcome="error",tool="generate_diagram"} 1`,
+		`kroki_mcp_tool_calls_total{diagram_type="graphviz",format="png",outcome="ok",tool="generate_png_diagram_with_custom_dpi"} 1`,
+		`kroki_mcp_tool_response_bytes_count{diagram_type="mermaid",format="svg",tool="generate_diagram"} 2`,
+		`kroki_mcp_render_cache_lookups_total{result="hit"} 1`,
+		`kroki_mcp_render_cache_lookups_total{result="miss"} 2`,
+		`kroki_mcp_svg_conversion_duration_seconds_count{format="png"} 1`,
+		`kroki_mcp_kroki_requests_total{backend="` + host + `",code="200"} 2`,
+		`kroki_mcp_active_sessions 1`,
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
+
+// 21. With tracing enabled, trace context in a tool call's _meta is the
+// parent of the tool span, and the Kroki request and every local SVG stage
+// get spans of their own in the same trace.
+func TestTracing(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	host, _ := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, name := range []string{"generate_diagram", "generate_png_diagram_with_custom_dpi"} {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = map[string]any{"diagramType": "graphviz", "source": "digraph{a->b}"}
+		req.Params.Meta = &mcp.Meta{AdditionalFields: map[string]any{
+			"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01",
+		}}
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool %s: %v", name, err)
+		}
+		if result.IsError {
+			t.Fatalf("%s returned an error: %s", name, firstTextContent(t, result))
+		}
+	}
+
+	traced := map[string]int{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			traced[span.Name()]++
+		}
+	}
+	for name, count := range map[string]int{
+		"mcp.tools/call":                            2,
+		"tool.generate_diagram":                     1,
+		"tool.generate_png_diagram_with_custom_dpi": 1,
+		"kroki.RenderDiagram":                       2,
+		"POST":                                      2,
+		"svgconv.NormalizeForInline":                1,
+		"svgconv.MinifySVG":                         1,
+		"svgconv.Convert":                           1,
+	} {
+		if traced[name] != count {
+			t.Errorf("%d %q spans in the caller's trace, want %d (got %v)", traced[name], name, count, traced)
+		}
+	}
+}
+
+// 22. UpdateConfig re-registers the tools when their definitions change,
+// notifying connected clients, and SetKrokiClient routes the following calls
+// to the new client. Types outside the enabled set are rejected.
+func TestUpdateConfigAndSetKrokiClient(t *testing.T) {
+	host := newGuardedKrokiHost(t)
+	krokiClient, err := kroki.NewKrokiClient(host)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s := NewKrokiMCPServer(&config.Config{KrokiHost: host}, krokiClient)
+	c, _ := newInitializedClient(t, s.Handler())
+	listChanged := make(chan struct{}, 10)
+	c.OnNotification(func(n mcp.JSONRPCNotification) {
+		if n.Method == string(mcp.MethodNotificationToolsListChanged) {
+			listChanged <- struct{}{}
+		}
+	})
+	diagramTypeEnum := func(t *testing.T) []any {
+		t.Helper()
+		result, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatalf("ListTools: %v", err)
+		}
+		for _, tool := range result.Tools {
+			if tool.Name == "generate_diagram" {
+				property, _ := tool.InputSchema.Properties["diagramType"].(map[string]any)
+				enum, _ := property["enum"].([]any)
+				return enum
+			}
+		}
+		t.Fatal("generate_diagram is not listed")
+		return nil
+	}
+	generate := func(t *testing.T, diagramType string) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = map[string]any{"diagramType": diagramType, "source": "A -> B"}
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+
+	if s.UpdateConfig(&config.Config{KrokiHost: host}) {
+		t.Error("UpdateConfig with an unchanged configuration reported changed tools")
+	}
+	if !s.UpdateConfig(&config.Config{KrokiHost: host, DiagramTypes: []string{"plantuml", "mermaid"}}) {
+		t.Fatal("UpdateConfig restricting the diagram types reported unchanged tools")
+	}
+	select {
+	case <-listChanged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notifications/tools/list_changed after the tools changed")
+	}
+	if enum := diagramTypeEnum(t); !slices.Equal(enum, []any{"plantuml", "mermaid", "auto"}) {
+		t.Errorf("diagramType enum = %v, want [plantuml mermaid auto]", enum)
+	}
+	if result := generate(t, "graphviz"); !result.IsError || !strings.Contains(firstTextContent(t, result), "not enabled") {
+		t.Errorf("disabled diagram type: IsError=%v, want a \"not enabled\" error", result.IsError)
+	}
+
+	stubHost, recorder := newStubKrokiHost(t)
+	stubClient, err := kroki.NewKrokiClient(stubHost)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s.SetKrokiClient(stubClient)
+	if result := generate(t, "plantuml"); result.IsError {
+		t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+	}
+	if got := recorder.only(t).Body.DiagramType; got != "plantuml" {
+		t.Errorf("new client rendered %q, want plantuml", got)
+	}
+
+	if s.UpdateConfig(&config.Config{KrokiHost: stubHost, DiagramTypes: []string{"plantuml", "mermaid"}}) {
+		t.Error("UpdateConfig with unchanged tool definitions reported changed tools")
+	}
+	select {
+	case <-listChanged:
+		t.Error("notifications/tools/list_changed sent although the tools did not change")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// 23. The diagram type registry drives argument validation: an alias is
+// forwarded to Kroki under the type's name, a format Kroki cannot render the
+// type to is rejected before any network call, and diagrams://types/{name}
+// describes each accepted type.
+func TestDiagramTypeRegistry(t *testing.T) {
+	host, recorder := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+	call := func(t *testing.T, arguments map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = arguments
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+
+	result := call(t, map[string]any{"diagramType": "wavedrom", "source": "{ signal: [] }", "format": "png"})
+	if !result.IsError || !strings.Contains(firstTextContent(t, result), "diagram type wavedrom cannot be rendered as png") {
+		t.Errorf("png for wavedrom: IsError=%v, want an unsupported format error", result.IsError)
+	}
+	if result := call(t, map[string]any{"diagramType": "DOT", "source": "digraph { a -> b }", "format": "svg"}); result.IsError {
+		t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+	}
+	if got := recorder.only(t).Body.DiagramType; got != "graphviz" {
+		t.Errorf("alias dot forwarded as %q, want graphviz", got)
+	}
+
+	read := mcp.ReadResourceRequest{}
+	read.Params.URI = "diagrams://types/graphviz"
+	resource, err := c.ReadResource(context.Background(), read)
+	if err != nil {
+		t.Fatalf("ReadResource: %v", err)
+	}
+	text, ok := resource.Contents[0].(mcp.TextResourceContents)
+	if !ok {
+		t.Fatalf("expected TextResourceContents, got %T", resource.Contents[0])
+	}
+	var diagram model.DiagramType
+	if err := json.Unmarshal([]byte(text.Text), &diagram); err != nil {
+		t.Fatalf("resource is not a diagram type: %v", err)
+	}
+	if diagram.Name != "graphviz" || !slices.Contains(diagram.Aliases, "dot") || !diagram.SupportsFormat(model.PDF) || diagram.Example == "" {
+		t.Errorf("diagrams://types/graphviz = %+v", diagram)
+	}
+	read.Params.URI = "diagrams://types/visio"
+	if _, err := c.ReadResource(context.Background(), read); err == nil {
+		t.Error("reading an unknown diagram type succeeded")
+	}
+}
+
+// 24. DiscoverDiagramTypes limits the tools, diagrams://types and the
+// accepted types to what the Kroki backend reports rendering, notifying
+// clients, and exposes the engine versions it reported.
+func TestDiscoverDiagramTypes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		// A self-hosted Kroki without the companion containers.
+		w.Write([]byte(`{"status":"pass","version":{"kroki":{"number":"0.28.0"},"plantuml":"1.2025.4","graphviz":"12.2.1"}}`))
+	}))
+	t.Cleanup(ts.Close)
+	krokiClient, err := kroki.NewKrokiClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewKrokiClient: %v", err)
+	}
+	s := NewKrokiMCPServer(&config.Config{KrokiHost: ts.URL}, krokiClient)
+	c, _ := newInitializedClient(t, s.Handler())
+	listChanged := make(chan struct{}, 10)
+	c.OnNotification(func(n mcp.JSONRPCNotification) {
+		if n.Method == string(mcp.MethodNotificationToolsListChanged) {
+			listChanged <- struct{}{}
+		}
+	})
+
+	if s.EngineVersions() != nil {
+		t.Error("EngineVersions before any discovery is not nil")
+	}
+	if err := s.DiscoverDiagramTypes(context.Background()); err != nil {
+		t.Fatalf("DiscoverDiagramTypes: %v", err)
+	}
+	select {
+	case <-listChanged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notifications/tools/list_changed after discovery removed types")
+	}
+
+	tools, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	for _, tool := range tools.Tools {
+		property, _ := tool.InputSchema.Properties["diagramType"].(map[string]any)
+		enum, _ := property["enum"].([]any)
+		if slices.Contains(enum, any("mermaid")) || !slices.Contains(enum, any("plantuml")) {
+			t.Errorf("%s diagramType enum = %v, want plantuml without mermaid", tool.Name, enum)
+		}
+	}
+
+	read := mcp.ReadResourceRequest{}
+	read.Params.URI = "diagrams://types"
+	resource, err := c.ReadResource(context.Background(), read)
+	if err != nil {
+		t.Fatalf("ReadResource: %v", err)
+	}
+	var types []string
+	if err := json.Unmarshal([]byte(resource.Contents[0].(mcp.TextResourceContents).Text), &types); err != nil {
+		t.Fatalf("diagrams://types is not a list: %v", err)
+	}
+	if slices.Contains(types, "bpmn") || !slices.Contains(types, "graphviz") {
+		t.Errorf("diagrams://types = %v, want graphviz without bpmn", types)
+	}
+	read.Params.URI = "diagrams://types/plantuml"
+	resource, err = c.ReadResource(context.Background(), read)
+	if err != nil {
+		t.Fatalf("ReadResource: %v", err)
+	}
+	if text := resource.Contents[0].(mcp.TextResourceContents).Text; !strings.Contains(text, `"engineVersion":"1.2025.4"`) {
+		t.Errorf("diagrams://types/plantuml = %s, want the discovered engine version", text)
+	}
+	if versions := s.EngineVersions(); versions[ts.URL]["kroki"] != "0.28.0" {
+		t.Errorf("EngineVersions = %v, want the reported Kroki version", versions)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "get_diagram_url"
+	req.Params.Arguments = map[string]any{"diagramType": "mermaid", "source": "graph TD; A-->B;"}
+	result, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !result.IsError || !strings.Contains(firstTextContent(t, result), "not available on the Kroki backends") {
+		t.Errorf("undiscovered type: IsError=%v, want a \"not available\" error", result.IsError)
+	}
+
+	// A failed discovery keeps the types found last.
+	ts.Close()
+	if err := s.DiscoverDiagramTypes(context.Background()); err == nil {
+		t.Error("DiscoverDiagramTypes with the backend down succeeded")
+	}
+	if got := s.diagramTypes(); slices.Contains(got, "mermaid") || !slices.Contains(got, "plantuml") {
+		t.Errorf("diagram types after a failed discovery = %v, want the previous result", got)
+	}
+}
+
+// 25. An omitted or auto diagramType is detected from the source, and a
+// declared type that disagrees with the source gets a warning in the result.
+func TestDiagramTypeDetection(t *testing.T) {
+	host, recorder := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+	call := func(t *testing.T, arguments map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = arguments
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+	lastText := func(result *mcp.CallToolResult) string {
+		text, _ := result.Content[len(result.Content)-1].(mcp.TextContent)
+		return text.Text
+	}
+
+	result := call(t, map[string]any{"source": "digraph G { a -> b }"})
+	if result.IsError {
+		t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+	}
+	if got := recorder.only(t).Body.DiagramType; got != "graphviz" {
+		t.Errorf("omitted diagramType forwarded as %q, want graphviz", got)
+	}
+	if !strings.Contains(lastText(result), "diagramType graphviz was detected") {
+		t.Errorf("last content = %q, want a detection note", lastText(result))
+	}
+
+	result = call(t, map[string]any{"diagramType": "auto", "source": "+--+\n|  |\n+--+"})
+	if !result.IsError || !strings.Contains(firstTextContent(t, result), "could not be detected") {
+		t.Errorf("undetectable source: IsError=%v, want a detection error", result.IsError)
+	}
+
+	result = call(t, map[string]any{"diagramType": "mermaid", "source": "digraph G { a -> b }"})
+	if !strings.Contains(lastText(result), "diagramType is mermaid but the source looks like graphviz") {
+		t.Errorf("last content = %q, want a mismatch warning", lastText(result))
+	}
+	result = call(t, map[string]any{"diagramType": "plantuml", "source": "@startuml\n!include <C4/C4_Context>\n@enduml"})
+	if len(result.Content) != 1 {
+		t.Errorf("C4 source labelled plantuml got %d content blocks, want no warning", len(result.Content))
+	}
+}
+
+// 26. generate_diagram requests the formats Kroki renders the diagram type
+// to and converts the type's SVG locally to the others; PDF comes back as an
+// embedded resource and raster formats as images. get_diagram_url only links
+// to formats Kroki renders.
+func TestGenerateDiagram_AdditionalFormats(t *testing.T) {
+	host, recorder := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+	call := func(t *testing.T, tool string, arguments map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = tool
+		req.Params.Arguments = arguments
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		if len(result.Content) == 0 {
+			t.Fatal("empty result")
+		}
+		return result
+	}
+	lastFormat := func() string {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return recorder.requests[len(recorder.requests)-1].Body.OutputFormat
+	}
+
+	result := call(t, "generate_diagram", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "format": "pdf"})
+	if result.IsError {
+		t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+	}
+	resource, ok := result.Content[0].(mcp.EmbeddedResource)
+	if !ok {
+		t.Fatalf("expected EmbeddedResource, got %T", result.Content[0])
+	}
+	if blob, ok := resource.Resource.(mcp.BlobResourceContents); !ok || blob.MIMEType != "application/pdf" || blob.Blob == "" {
+		t.Errorf("PDF resource = %+v, want an application/pdf blob", resource.Resource)
+	}
+	if got := lastFormat(); got != "pdf" {
+		t.Errorf("graphviz pdf requested from Kroki as %q, want pdf", got)
+	}
+
+	result = call(t, "generate_diagram", map[string]any{"diagramType": "mermaid", "source": "graph TD; A-->B;", "format": "jpeg"})
+	if result.IsError {
+		t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+	}
+	image, ok := result.Content[0].(mcp.ImageContent)
+	if !ok {
+		t.Fatalf("expected ImageContent, got %T", result.Content[0])
+	}
+	data, err := base64.StdEncoding.DecodeString(image.Data)
+	if err != nil || image.MIMEType != "image/jpeg" || !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		t.Errorf("mermaid jpeg = %s image (decode error %v), want a JPEG", image.MIMEType, err)
+	}
+	if got := lastFormat(); got != "svg" {
+		t.Errorf("mermaid jpeg requested from Kroki as %q, want svg to convert", got)
+	}
+
+	result = call(t, "get_diagram_url", map[string]any{"diagramType": "mermaid", "source": "graph TD; A-->B;", "format": "pdf"})
+	if !result.IsError || !strings.Contains(firstTextContent(t, result), "use generate_diagram to convert its SVG instead") {
+		t.Errorf("pdf URL for mermaid: IsError=%v, want an unsupported format error", result.IsError)
+	}
+}
+
+// 27. background and quality convert the diagram's SVG locally, even for a
+// format Kroki renders, and background flattens the PNGs of
+// generate_png_diagram_with_custom_dpi. Invalid values and formats the
+// arguments do not apply to are rejected before calling Kroki.
+func TestConversionBackgroundAndQuality(t *testing.T) {
+	host, recorder := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+	call := func(t *testing.T, tool string, arguments map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = tool
+		req.Params.Arguments = arguments
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+	decode := func(t *testing.T, result *mcp.CallToolResult) image.Image {
+		t.Helper()
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", firstTextContent(t, result))
+		}
+		content, ok := result.Content[0].(mcp.ImageContent)
+		if !ok {
+			t.Fatalf("expected ImageContent, got %T", result.Content[0])
+		}
+		data, err := base64.StdEncoding.DecodeString(content.Data)
+		if err != nil {
+			t.Fatalf("decode base64: %v", err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode image: %v", err)
+		}
+		return img
+	}
+
+	for _, tt := range []struct {
+		name      string
+		arguments map[string]any
+		wantMsg   string
+	}{
+		{name: "invalid background", arguments: map[string]any{"format": "jpeg", "background": "pinkish"}, wantMsg: "background must be a CSS color"},
+		{name: "quality out of range", arguments: map[string]any{"format": "jpeg", "quality": 0}, wantMsg: "quality must be an integer between 1 and 100"},
+		{name: "quality for pdf", arguments: map[string]any{"format": "pdf", "quality": 80}, wantMsg: "quality applies to jpeg output only"},
+		{name: "background for png", arguments: map[string]any{"format": "png", "background": "white"}, wantMsg: "use generate_png_diagram_with_custom_dpi with background"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			arguments := map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }"}
+			maps.Copy(arguments, tt.arguments)
+			result := call(t, "generate_diagram", arguments)
+			if !result.IsError || !strings.Contains(firstTextContent(t, result), tt.wantMsg) {
+				t.Errorf("IsError=%v, want an error containing %q", result.IsError, tt.wantMsg)
+			}
+		})
+	}
+	recorder.mu.Lock()
+	n := len(recorder.requests)
+	recorder.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("rejected calls made %d Kroki requests", n)
+	}
+
+	// graphviz renders jpeg natively, but Kroki takes no quality.
+	decode(t, call(t, "generate_diagram", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "format": "jpeg", "quality": 75, "background": "black"}))
+	if got := recorder.only(t).Body.OutputFormat; got != "svg" {
+		t.Errorf("jpeg with quality requested from Kroki as %q, want svg to convert", got)
+	}
+
+	img := decode(t, call(t, "generate_png_diagram_with_custom_dpi", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "dpi": 72, "background": "#1e1e1e"}))
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("flattened PNG corner alpha = %d, want opaque", a)
+	}
+	result := call(t, "generate_png_diagram_with_custom_dpi", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "background": "pinkish"})
+	if !result.IsError || !strings.Contains(firstTextContent(t, result), "background must be a CSS color") {
+		t.Errorf("invalid PNG background: IsError=%v, want an error", result.IsError)
+	}
+}
+
+// 28. format text returns the diagram as text art in a fenced block: Kroki's
+// utxt rendering, or txt with ascii. Types without text output, including
+// the ASCII-art ditaa, are rejected by the registry.
+func TestGenerateDiagram_TextOutput(t *testing.T) {
+	host, recorder := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+	call := func(t *testing.T, tool string, arguments map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = tool
+		req.Params.Arguments = arguments
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+	formats := func() []string {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		var formats []string
+		for _, r := range recorder.requests {
+			formats = append(formats, r.Body.OutputFormat)
+		}
+		return formats
+	}
+
+	result := call(t, "generate_diagram", map[string]any{"diagramType": "plantuml", "source": "@startuml\nA -> B\n@enduml", "format": "text"})
+	if text := firstTextContent(t, result); result.IsError || !strings.HasPrefix(text, "```text\n") || !strings.HasSuffix(text, "\n```") {
+		t.Errorf("plantuml text = %q, want a fenced text block", text)
+	}
+	call(t, "generate_diagram", map[string]any{"diagramType": "plantuml", "source": "@startuml\nA -> B\n@enduml", "format": "text", "ascii": true})
+	if got := formats(); !slices.Equal(got, []string{"utxt", "txt"}) {
+		t.Errorf("Kroki output formats = %v, want [utxt txt]", got)
+	}
+
+	for _, tt := range []struct{ diagramType, source string }{
+		{diagramType: "ditaa", source: "+---+\n| A |\n+---+"},
+		{diagramType: "mermaid", source: "graph TD; A-->B;"},
+	} {
+		result = call(t, "generate_diagram", map[string]any{"diagramType": tt.diagramType, "source": tt.source, "format": "text"})
+		if !result.IsError || !strings.Contains(firstTextContent(t, result), "text output is available for: c4plantuml, plantuml, structurizr") {
+			t.Errorf("%s text: IsError=%v, want the registry's rejection", tt.diagramType, result.IsError)
+		}
+	}
+	if got := formats(); len(got) != 2 {
+		t.Errorf("rejected text requests reached Kroki: %v", got)
+	}
+	result = call(t, "get_diagram_url", map[string]any{"diagramType": "plantuml", "source": "@startuml\nA -> B\n@enduml", "format": "text"})
+	if !result.IsError || !strings.Contains(firstTextContent(t, result), "use generate_diagram for text") {
+		t.Errorf("text URL: IsError=%v, want an error", result.IsError)
+	}
+}
+
+func TestFencedText(t *testing.T) {
+	if got := fencedText("a\n```\nb\n\n"); got != "````text\na\n```\nb\n````" {
+		t.Errorf("fencedText = %q", got)
+	}
+}
+
+// 29. theme adapts the SVG generate_diagram returns to the page theme, auto
+// through a prefers-color-scheme stylesheet, and is rejected where it cannot
+// apply.
+func TestGenerateDiagram_Theme(t *testing.T) {
+	host, _ := newStubKrokiHost(t)
+	c, _ := newInitializedClient(t, newTestServerWithHost(t, host))
+	call := func(t *testing.T, tool string, arguments map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = tool
+		req.Params.Arguments = arguments
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return result
+	}
+
+	plain := firstTextContent(t, call(t, "generate_diagram", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }"}))
+	themed := call(t, "generate_diagram", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "theme": "auto"})
+	if themed.IsError || !strings.Contains(firstTextContent(t, themed), "prefers-color-scheme: dark") {
+		t.Errorf("theme auto: IsError=%v, want the media query stylesheet in %q", themed.IsError, firstTextContent(t, themed))
+	}
+	if strings.Contains(plain, "prefers-color-scheme") {
+		t.Error("the cached plain SVG carries the theme stylesheet")
+	}
+
+	for _, tt := range []struct {
+		tool      string
+		arguments map[string]any
+		wantMsg   string
+	}{
+		{tool: "generate_diagram", arguments: map[string]any{"theme": "sepia"}, wantMsg: "theme must be one of: light, dark, auto"},
+		{tool: "generate_diagram", arguments: map[string]any{"theme": "auto", "format": "jpeg"}, wantMsg: "applies to svg output only"},
+		{tool: "generate_diagram", arguments: map[string]any{"theme": "dark", "format": "png"}, wantMsg: "use generate_png_diagram_with_custom_dpi with theme"},
+		{tool: "generate_png_diagram_with_custom_dpi", arguments: map[string]any{"theme": "auto"}, wantMsg: "applies to svg output only"},
+	} {
+		arguments := map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }"}
+		maps.Copy(arguments, tt.arguments)
+		result := call(t, tt.tool, arguments)
+		if !result.IsError || !strings.Contains(firstTextContent(t, result), tt.wantMsg) {
+			t.Errorf("%s %v: IsError=%v, want an error containing %q", tt.tool, tt.arguments, result.IsError, tt.wantMsg)
+		}
+	}
+	if result := call(t, "generate_png_diagram_with_custom_dpi", map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "dpi": 72, "theme": "dark"}); result.IsError {
+		t.Errorf("dark PNG: %s", firstTextContent(t, result))
+	}
+}
+
+// 30. generate_diagram sanitizes the SVG it returns inline with the
+// configured --svg-sanitize policy: standard by default, strict dropping
+// foreignObject labels, and off returning Kroki's markup as it is.
+func TestGenerateDiagram_SanitizesSVG(t *testing.T) {
+	const hostile = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10" onload="alert(1)"><script>alert(2)</script><a href="javascript:alert(3)"><rect width="5" height="5"/></a><foreignObject width="10" height="10"><div xmlns="http://www.w3.org/1999/xhtml">label</div></foreignObject></svg>`
+	host, _ := newStubKrokiHostServing(t, hostile)
+	generate := func(t *testing.T, policy string) string {
+		t.Helper()
+		krokiClient, err := kroki.NewKrokiClient(host)
+		if err != nil {
+			t.Fatalf("NewKrokiClient: %v", err)
+		}
+		s := NewKrokiMCPServer(&config.Config{KrokiHost: host, SVGSanitize: policy}, krokiClient)
+		c, _ := newInitializedClient(t, s.Handler())
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "generate_diagram"
+		req.Params.Arguments = map[string]any{"diagramType": "graphviz", "source": "digraph { a -> b }", "format": "svg"}
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("%s: %s", policy, firstTextContent(t, result))
+		}
+		return firstTextContent(t, result)
+	}
+
+	for _, policy := range []string{"", "standard", "strict"} {
+		got := generate(t, policy)
+		if strings.Contains(got, "alert") || strings.Contains(got, "<script") {
+			t.Errorf("policy %q returned active content: %s", policy, got)
+		}
+		if !strings.Contains(got, `<rect width="5" height="5"`) {
+			t.Errorf("policy %q removed the diagram: %s", policy, got)
+		}
+		if keepsLabel := strings.Contains(got, "label"); keepsLabel != (policy != "strict") {
+			t.Errorf("policy %q: foreignObject label kept=%v: %s", policy, keepsLabel, got)
+		}
+	}
+	if got := generate(t, "off"); !strings.Contains(got, "<script>alert(2)</script>") {
+		t.Errorf("policy off changed the SVG: %s", got)
+	}
+}
@@ -4,14 +4,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"net/http"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/utain/kroki-mcp/internal/cache"
+	"github.com/utain/kroki-mcp/internal/kroki"
 	"github.com/utain/kroki-mcp/internal/model"
 	"github.com/utain/kroki-mcp/internal/svgconv"
+	"github.com/utain/kroki-mcp/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // defaultDPI is the single source of truth for the DPI used by
@@ -25,16 +36,82 @@ const defaultDPI = 150
 // this limit the tool points the caller at the URL or PNG alternatives.
 const maxInlineSVGBytes = 100 * 1024
 
+// Cache key PostProcess values for the local transformations tools apply to
+// Kroki's output.
+const (
+	postProcessInlineSVG = "inline-svg"
+	postProcessRasterize = "rasterize"
+	postProcessConvert   = "convert"
+)
+
+// cachedRender returns the output stored under key in the render cache, or
+// calls render with the current Kroki client on a miss and caches its
+// result. Without a cache it just calls render. The key is completed with
+// the client's backends, so a reload pointing at other servers starts from
+// a cold cache.
+func (s *KrokiMCPServer) cachedRender(key cache.Key, render func(kc *kroki.KrokiClient) ([]byte, error)) ([]byte, error) {
+	kc := s.KrokiClient()
+	if s.cache == nil {
+		return render(kc)
+	}
+	for _, b := range kc.Backends() {
+		id := b.URL
+		if len(b.DiagramTypes) > 0 {
+			id += ";types=" + strings.Join(b.DiagramTypes, ",")
+		}
+		key.Backends = append(key.Backends, id)
+	}
+	id := key.String()
+	if data, ok := s.cache.Get(id); ok {
+		s.metrics.CacheLookup(true)
+		slog.Debug("Render cache hit", "key", id[:12], "diagramType", key.DiagramType, "format", key.Format)
+		return data, nil
+	}
+	s.metrics.CacheLookup(false)
+	slog.Debug("Render cache miss", "key", id[:12], "diagramType", key.DiagramType, "format", key.Format)
+	data, err := render(kc)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Put(id, data)
+	return data, nil
+}
+
 // parseDiagramArgs validates the shared tool arguments and returns them
-// normalized to lowercase (except source). A non-nil errResult must be
-// returned to the client as-is.
-func parseDiagramArgs(req mcp.CallToolRequest, needsFormat bool) (diagramType, source, format string, errResult *mcp.CallToolResult) {
+// normalized to lowercase (except source), with a diagram type alias
+// resolved to the type's name. An omitted or auto diagram type is detected
+// from the source. defaultFormat applies when the caller omits format; tools
+// without a format argument pass "" and get an empty format back. Whether the
+// diagram type can be produced in the format is left to checkFormat. A
+// non-nil errResult must be returned to the client as-is.
+func (s *KrokiMCPServer) parseDiagramArgs(req mcp.CallToolRequest, defaultFormat string) (diagramType, source, format string, errResult *mcp.CallToolResult) {
 	rawDiagramType := req.GetString("diagramType", "")
-	diagramType = strings.ToLower(rawDiagramType)
-	if !slices.Contains(model.SupportedDiagramTypes, diagramType) {
+	if isAutoDiagramType(rawDiagramType) {
+		rawDiagramType = model.DetectDiagramType(req.GetString("source", ""))
+		if rawDiagramType == "" && req.GetString("source", "") != "" {
+			slog.Error("Diagram type not detected from the source")
+			return "", "", "", mcp.NewToolResultError("diagramType could not be detected from the source; pass it explicitly, see diagrams://types for the available types")
+		}
+	}
+	diagram, ok := model.Diagrams.Lookup(rawDiagramType)
+	if !ok && rawDiagramType == "" {
+		// Detection needs a source; report that rather than the type.
+		slog.Error("Invalid source value", "source", "")
+		return "", "", "", mcp.NewToolResultError("source is required and must be a non-empty string")
+	}
+	if !ok {
 		slog.Error("Invalid diagramType value", "diagramType", rawDiagramType)
 		return "", "", "", mcp.NewToolResultError("diagramType is required and must be a non-empty string")
 	}
+	diagramType = diagram.Name
+	if !slices.Contains(s.enabledDiagramTypes(), diagramType) {
+		slog.Error("Diagram type not enabled", "diagramType", diagramType)
+		return "", "", "", mcp.NewToolResultError(fmt.Sprintf("diagramType %q is not enabled on this server; see diagrams://types for the enabled types", diagramType))
+	}
+	if !s.available(diagramType) {
+		slog.Error("Diagram type not available", "diagramType", diagramType)
+		return "", "", "", mcp.NewToolResultError(fmt.Sprintf("diagramType %q is not available on the Kroki backends; see diagrams://types for the available types", diagramType))
+	}
 
 	source = req.GetString("source", "")
 	if source == "" {
@@ -42,36 +119,348 @@ func parseDiagramArgs(req mcp.CallToolRequest, needsFormat bool) (diagramType, s
 		return "", "", "", mcp.NewToolResultError("source is required and must be a non-empty string")
 	}
 
-	if needsFormat {
-		rawFormat := req.GetString("format", "")
+	if defaultFormat != "" {
+		rawFormat := req.GetString("format", defaultFormat)
 		format = strings.ToLower(rawFormat)
 		if !slices.Contains(model.SupportedOutputFormats, format) {
 			slog.Error("Invalid format value", "format", rawFormat)
-			return "", "", "", mcp.NewToolResultError("format is required and must be one of: png, svg")
+			return "", "", "", mcp.NewToolResultError("format is required and must be one of: " + strings.Join(model.SupportedOutputFormats, ", "))
 		}
 	}
 
 	return diagramType, source, format, nil
 }
 
+// localFormats are the formats generate_diagram converts a diagram's SVG to
+// when Kroki does not render the diagram type to them. PNG is left to
+// generate_png_diagram_with_custom_dpi, which takes the DPI, and WebP and
+// AVIF to builds that support them.
+var localFormats = slices.DeleteFunc([]model.OutputFormat{model.JPEG, model.PDF, model.WEBP, model.AVIF}, func(f model.OutputFormat) bool {
+	return !slices.Contains(model.SupportedOutputFormats, string(f))
+})
+
+// localFormatList lists localFormats for messages, as "jpeg, pdf and webp".
+func localFormatList() string {
+	names := make([]string, len(localFormats))
+	for i, f := range localFormats {
+		names[i] = string(f)
+	}
+	last := len(names) - 1
+	return strings.Join(names[:last], ", ") + " and " + names[last]
+}
+
+// convertible reports whether generate_diagram can produce format by
+// converting the SVG Kroki renders diagramType to.
+func convertible(diagramType, format string) bool {
+	diagram, ok := model.Diagrams.Lookup(diagramType)
+	return ok && diagram.SupportsFormat(model.SVG) && slices.Contains(localFormats, model.OutputFormat(format))
+}
+
+// convertsLocally reports whether format is produced by converting the SVG
+// Kroki renders diagramType to because Kroki does not render the type to it.
+func convertsLocally(diagramType, format string) bool {
+	diagram, ok := model.Diagrams.Lookup(diagramType)
+	return ok && !diagram.SupportsFormat(model.OutputFormat(format)) && convertible(diagramType, format)
+}
+
+// themeAutoSVGOnly rejects theme auto for output that is not SVG.
+const themeAutoSVGOnly = "theme auto follows the viewer's color scheme and applies to svg output only; use light or dark"
+
+// conversionArgs holds the optional background and quality arguments of a
+// local SVG conversion.
+type conversionArgs struct {
+	background string
+	quality    int
+	theme      svgconv.Theme
+}
+
+// set reports whether the caller gave any of the arguments.
+func (a conversionArgs) set() bool {
+	return a.background != "" || a.quality != 0 || a.theme != ""
+}
+
+// parseConversionArgs validates the background and theme arguments and,
+// with withQuality, the quality argument. A non-nil errResult must be
+// returned to the client as-is.
+func parseConversionArgs(req mcp.CallToolRequest, withQuality bool) (args conversionArgs, errResult *mcp.CallToolResult) {
+	if raw := req.GetString("theme", ""); raw != "" {
+		theme, err := svgconv.ParseTheme(raw)
+		if err != nil {
+			slog.Error("Invalid theme value", "theme", raw)
+			return args, mcp.NewToolResultError("theme must be one of: " + strings.Join(svgconv.Themes, ", "))
+		}
+		args.theme = theme
+	}
+	args.background = strings.TrimSpace(req.GetString("background", ""))
+	if args.background != "" {
+		if _, err := svgconv.ParseColor(args.background); err != nil {
+			slog.Error("Invalid background value", "background", args.background, "error", err)
+			return args, mcp.NewToolResultError("background must be a CSS color, e.g. white, #1e1e1e or rgb(30, 30, 30)")
+		}
+	}
+	if _, present := req.GetArguments()["quality"]; withQuality && present {
+		quality, err := req.RequireFloat("quality")
+		if err != nil || quality != math.Trunc(quality) || quality < 1 || quality > 100 {
+			slog.Error("Invalid quality value", "quality", req.GetArguments()["quality"])
+			return args, mcp.NewToolResultError("quality must be an integer between 1 and 100")
+		}
+		args.quality = int(quality)
+	}
+	return args, nil
+}
+
+// checkFormat returns an error result when diagramType cannot be produced as
+// format: Kroki does not render it to the format and, unless convert is set,
+// the format is not converted locally either.
+func checkFormat(diagramType, format string, convert bool) *mcp.CallToolResult {
+	err := model.Diagrams.CheckFormat(diagramType, model.OutputFormat(format))
+	if err == nil || (convert && convertsLocally(diagramType, format)) {
+		return nil
+	}
+	slog.Error("Unsupported format for diagram type", "diagramType", diagramType, "format", format)
+	message := err.Error()
+	switch {
+	case format == string(model.PNG):
+		message += "; use generate_png_diagram_with_custom_dpi to rasterize its SVG instead"
+	case convertsLocally(diagramType, format):
+		message += "; use generate_diagram to convert its SVG instead"
+	}
+	return mcp.NewToolResultError(message)
+}
+
+// renderText returns the diagram as text art in a fenced block, as Kroki
+// renders it in Unicode, or with ascii in ASCII only.
+func (s *KrokiMCPServer) renderText(ctx context.Context, diagramType, source string, options map[string]string, ascii bool) *mcp.CallToolResult {
+	format := model.UTXT
+	if ascii {
+		format = model.TXT
+	}
+	key := cache.Key{DiagramType: diagramType, Source: source, Format: string(format), Options: options}
+	content, err := s.cachedRender(key, func(kc *kroki.KrokiClient) ([]byte, error) {
+		result, err := kc.RenderDiagramContext(ctx, diagramType, source, format, options)
+		if err != nil {
+			return nil, err
+		}
+		return result.ImageContent, nil
+	})
+	if err != nil {
+		slog.Error("Failed to render diagram", "error", err)
+		return renderErrorResult(err)
+	}
+	return mcp.NewToolResultText(fencedText(string(content)))
+}
+
+// fencedText wraps text in a Markdown code block, with a fence longer than
+// any backtick run inside it.
+func fencedText(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + "text\n" + strings.TrimRight(text, "\n") + "\n" + fence
+}
+
+// convertSVG converts a rendered SVG to format locally at dpi.
+func (s *KrokiMCPServer) convertSVG(ctx context.Context, svg []byte, format model.OutputFormat, dpi float64, args conversionArgs) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, span := telemetry.Start(ctx, "svgconv.Convert", trace.WithAttributes(
+		attribute.String("svgconv.format", string(format)),
+		attribute.Float64("svgconv.dpi", dpi),
+	))
+	start := time.Now()
+	err := svgconv.Convert(buf, string(svg), svgconv.Options{
+		Format:     svgconv.OutputFormat(format),
+		DPI:        dpi,
+		Background: args.background,
+		Quality:    args.quality,
+		Theme:      args.theme,
+	})
+	s.metrics.Conversion(string(format), time.Since(start))
+	telemetry.End(span, err)
+	if err != nil {
+		slog.Error("Failed to convert SVG", "format", format, "error", err)
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// binaryResult returns rendered bytes in format as an image content block,
+// or as an embedded resource for PDF, which clients do not display as an
+// image.
+func binaryResult(diagramType string, format model.OutputFormat, content []byte) *mcp.CallToolResult {
+	data := base64.StdEncoding.EncodeToString(content)
+	if format == model.PDF {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+					URI:      fmt.Sprintf("diagrams://rendered/%s.pdf", diagramType),
+					MIMEType: format.MIMEType(),
+					Blob:     data,
+				}),
+			},
+		}
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.ImageContent{
+				Type:     "image",
+				MIMEType: format.MIMEType(),
+				Data:     data,
+			},
+		},
+	}
+}
+
+// defaultFormat returns the output format a tool uses when the caller omits
+// format: the server-wide --format when one is configured, else toolDefault.
+func (s *KrokiMCPServer) defaultFormat(toolDefault model.OutputFormat) string {
+	if cfg := s.config(); cfg != nil && cfg.OutputFormat != "" {
+		return cfg.OutputFormat
+	}
+	return string(toolDefault)
+}
+
+// sanitizePolicy returns the name of the configured --svg-sanitize policy,
+// standard when none is configured, and the policy; ok is false when
+// sanitizing is off.
+func (s *KrokiMCPServer) sanitizePolicy() (name string, policy svgconv.SanitizePolicy, ok bool) {
+	name = "standard"
+	if cfg := s.config(); cfg != nil && cfg.SVGSanitize != "" {
+		name = cfg.SVGSanitize
+	}
+	policy, ok = svgconv.SanitizePolicies[name]
+	return name, policy, ok
+}
+
+// urlFormats are the formats get_diagram_url links to: a URL can only point
+// at what Kroki renders itself.
+var urlFormats = []string{string(model.PNG), string(model.SVG), string(model.JPEG), string(model.PDF)}
+
+// defaultURLFormat returns the format get_diagram_url uses when the caller
+// omits it: the server-wide default when Kroki can link to it, png otherwise.
+func (s *KrokiMCPServer) defaultURLFormat() string {
+	if format := s.defaultFormat(model.PNG); slices.Contains(urlFormats, format) {
+		return format
+	}
+	return string(model.PNG)
+}
+
+// diagramTypes returns the diagram types the tools accept: the enabled ones
+// the Kroki backends render.
+func (s *KrokiMCPServer) diagramTypes() []string {
+	return slices.DeleteFunc(slices.Clone(s.enabledDiagramTypes()), func(diagramType string) bool {
+		return !s.available(diagramType)
+	})
+}
+
+// enabledDiagramTypes returns the configured --diagram-types allowlist, or
+// every registered type.
+func (s *KrokiMCPServer) enabledDiagramTypes() []string {
+	if cfg := s.config(); cfg != nil && len(cfg.DiagramTypes) > 0 {
+		return cfg.DiagramTypes
+	}
+	return model.Diagrams.Names()
+}
+
+// parseDiagramOptions reads the optional options object and validates it
+// against the option catalog for diagramType. Scalar values are forwarded
+// to Kroki in their string form. A non-nil errResult must be returned to the
+// client as-is.
+func parseDiagramOptions(req mcp.CallToolRequest, diagramType string) (options map[string]string, errResult *mcp.CallToolResult) {
+	raw, present := req.GetArguments()["options"]
+	if !present || raw == nil {
+		return nil, nil
+	}
+	object, ok := raw.(map[string]any)
+	if !ok {
+		slog.Error("Invalid options value", "options", raw)
+		return nil, mcp.NewToolResultError("options must be an object mapping option names to values")
+	}
+
+	options = make(map[string]string, len(object))
+	for name, value := range object {
+		switch v := value.(type) {
+		case string:
+			options[name] = v
+		case bool:
+			options[name] = strconv.FormatBool(v)
+		case float64:
+			options[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			slog.Error("Invalid option value", "option", name, "value", value)
+			return nil, mcp.NewToolResultError(fmt.Sprintf("option %q must be a string, number or boolean", name))
+		}
+	}
+	if err := model.ValidateDiagramOptions(diagramType, options); err != nil {
+		slog.Error("Invalid diagram options", "diagramType", diagramType, "error", err)
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	return options, nil
+}
+
+// renderErrorResult turns a render failure into a tool error. A
+// *kroki.RenderError also goes back as structured content carrying the
+// engine's message and the line/column it points at, so the model can fix
+// the source in place.
+func renderErrorResult(err error) *mcp.CallToolResult {
+	result := mcp.NewToolResultError(err.Error())
+	var renderErr *kroki.RenderError
+	if errors.As(err, &renderErr) {
+		result.StructuredContent = renderErr
+	}
+	return result
+}
+
+// withDiagramType declares the diagramType argument shared by the tools,
+// which accepts the given types or auto.
+func withDiagramType(diagramTypes []string) mcp.ToolOption {
+	return mcp.WithString("diagramType",
+		mcp.Description("The diagram code syntax type (e.g., plantuml, mermaid, graphviz). Omit it or pass auto to detect it from the source."),
+		mcp.Enum(append(slices.Clone(diagramTypes), model.AutoDiagramType)...),
+	)
+}
+
+// withDiagramOptions declares the options argument shared by the
+// rendering tools.
+func withDiagramOptions() mcp.ToolOption {
+	return mcp.WithObject("options",
+		mcp.Description(`Optional Kroki diagram options for the diagram type, e.g. {"theme": "dark"} for mermaid, {"layout": "neato"} for graphviz, {"sketch": true} for d2 or {"no-transparency": true} for plantuml.`),
+	)
+}
+
 func (s *KrokiMCPServer) RegisterGenerateDiagramTool() {
+	s.mcp.AddTools(s.generateDiagramTool())
+}
+
+func (s *KrokiMCPServer) generateDiagramTool() server.ServerTool {
 	tool := mcp.NewTool("generate_diagram",
-		mcp.WithDescription("Generate a diagram from textual code using Kroki. Returns SVG markup as text (default, renders inline in chat) or a PNG image."),
-		mcp.WithString("diagramType",
-			mcp.Required(),
-			mcp.Description("The diagram code syntax type (e.g., plantuml, mermaid, graphviz)"),
-			mcp.Enum(model.SupportedDiagramTypes...),
-		),
+		mcp.WithDescription("Generate a diagram from textual code using Kroki. Returns SVG markup as text (default, renders inline in chat), a raster image, a PDF document or text art."),
+		withDiagramType(s.diagramTypes()),
 		mcp.WithString("source",
 			mcp.Required(),
 			mcp.Description("The textual diagram source code"),
 		),
 		mcp.WithString("format",
-			mcp.Required(),
-			mcp.Description("Output media format: svg or png."),
+			mcp.Description("Output media format: "+strings.Join(model.SupportedOutputFormats, ", ")+". Formats Kroki does not render the diagram type to are converted from its SVG. text returns the diagram as text art for "+strings.Join(model.Diagrams.TextTypes(), ", ")+", for terminals that cannot show images."),
 			mcp.Enum(model.SupportedOutputFormats...),
-			mcp.DefaultString("svg"),
+			mcp.DefaultString(s.defaultFormat(model.SVG)),
+		),
+		mcp.WithBoolean("ascii",
+			mcp.Description("With format text, draw with ASCII characters only instead of Unicode box drawing."),
 		),
+		mcp.WithString("background",
+			mcp.Description("CSS color painted behind "+localFormatList()+" output, e.g. white or #1e1e1e; jpeg defaults to white. Setting it converts the diagram's SVG locally."),
+		),
+		mcp.WithNumber("quality",
+			mcp.Description("JPEG quality from 1 to 100 (default 90). Setting it converts the diagram's SVG locally."),
+			mcp.Min(1),
+			mcp.Max(100),
+		),
+		mcp.WithString("theme",
+			mcp.Description("Adapt the diagram to a page theme: light removes its background, dark also turns black lines and text light and white fills dark, and auto (svg only) follows the viewer's prefers-color-scheme. Converts non-SVG output from the diagram's SVG locally."),
+			mcp.Enum(svgconv.Themes...),
+		),
+		withDiagramOptions(),
 		mcp.WithToolAnnotation(mcp.ToolAnnotation{
 			Title:           "Generate diagram image from source",
 			ReadOnlyHint:    mcp.ToBoolPtr(true),
@@ -81,40 +470,130 @@ func (s *KrokiMCPServer) RegisterGenerateDiagramTool() {
 		}),
 	)
 
-	s.mcp.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		diagramType, source, format, errResult := parseDiagramArgs(req, true)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		diagramType, source, format, errResult := s.parseDiagramArgs(req, s.defaultFormat(model.SVG))
+		if errResult == nil {
+			errResult = checkFormat(diagramType, format, true)
+		}
+		if errResult != nil {
+			return errResult, nil
+		}
+		options, errResult := parseDiagramOptions(req, diagramType)
 		if errResult != nil {
 			return errResult, nil
 		}
+		conversion, errResult := parseConversionArgs(req, true)
+		if errResult != nil {
+			return errResult, nil
+		}
+		isSVG := model.OutputFormat(format) == model.SVG
+		switch {
+		case conversion.quality != 0 && model.OutputFormat(format) != model.JPEG:
+			return mcp.NewToolResultError("quality applies to jpeg output only"), nil
+		case (conversion.background != "" || conversion.quality != 0) && !convertible(diagramType, format):
+			message := "background and quality apply to " + localFormatList() + " output converted from the diagram's SVG"
+			if model.OutputFormat(format) == model.PNG {
+				message += "; use generate_png_diagram_with_custom_dpi with background to flatten a PNG"
+			}
+			return mcp.NewToolResultError(message), nil
+		case conversion.theme != "" && !isSVG && !convertible(diagramType, format):
+			message := "theme applies to svg output and to " + localFormatList() + " output converted from the diagram's SVG"
+			if model.OutputFormat(format) == model.PNG {
+				message += "; use generate_png_diagram_with_custom_dpi with theme for a PNG"
+			}
+			return mcp.NewToolResultError(message), nil
+		case conversion.theme == svgconv.ThemeAuto && !isSVG:
+			return mcp.NewToolResultError(themeAutoSVGOnly), nil
+		}
 
-		result, err := s.krokiClient.RenderDiagram(diagramType, source, model.OutputFormat(format))
-		if err != nil {
-			slog.Error("Failed to render diagram", "error", err)
-			return mcp.NewToolResultError(err.Error()), nil
+		if model.OutputFormat(format) == model.TEXT {
+			return s.renderText(ctx, diagramType, source, options, req.GetBool("ascii", false)), nil
 		}
 
-		switch model.OutputFormat(format) {
-		case model.PNG:
-			data := base64.StdEncoding.EncodeToString(result.ImageContent)
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					mcp.ImageContent{
-						Type:     "image",
-						MIMEType: result.MIMEType,
-						Data:     data,
-					},
-				},
-			}, nil
-		case model.SVG:
+		key := cache.Key{DiagramType: diagramType, Source: source, Format: format, Options: options}
+		// Kroki takes no background, quality or theme, so setting one
+		// converts the SVG locally even when Kroki renders the format.
+		convert := convertsLocally(diagramType, format) || (!isSVG && conversion.set())
+		policyName, policy, sanitize := s.sanitizePolicy()
+		switch {
+		case isSVG:
+			key.PostProcess = postProcessInlineSVG
+			if sanitize {
+				key.PostProcess += "+sanitize=" + policyName
+			}
+			key.Theme = string(conversion.theme)
+		case convert:
+			key.PostProcess = postProcessConvert
+			key.DPI = defaultDPI
+			key.Background = conversion.background
+			key.Quality = conversion.quality
+			key.Theme = string(conversion.theme)
+		}
+		content, err := s.cachedRender(key, func(kc *kroki.KrokiClient) ([]byte, error) {
+			renderFormat := model.OutputFormat(format)
+			if convert {
+				renderFormat = model.SVG
+			}
+			result, err := kc.RenderDiagramContext(ctx, diagramType, source, renderFormat, options)
+			if err != nil {
+				return nil, err
+			}
+			if convert {
+				return s.convertSVG(ctx, result.ImageContent, model.OutputFormat(format), defaultDPI, conversion)
+			}
+			if model.OutputFormat(format) != model.SVG {
+				return result.ImageContent, nil
+			}
 			// Claude Desktop rejects image content blocks with image/svg+xml
 			// (only raster formats are supported), so SVG goes back as text,
 			// normalized so it renders inline on both light and dark themes.
+			_, span := telemetry.Start(ctx, "svgconv.NormalizeForInline")
 			svgOut := svgconv.NormalizeForInline(string(result.ImageContent))
-			if minified, err := svgconv.MinifySVG(svgOut); err == nil {
+			span.End()
+			if conversion.theme != "" {
+				_, span = telemetry.Start(ctx, "svgconv.ApplyTheme", trace.WithAttributes(
+					attribute.String("svgconv.theme", string(conversion.theme)),
+				))
+				svgOut = svgconv.ApplyTheme(svgOut, conversion.theme)
+				span.End()
+			}
+			if sanitize {
+				// The SVG may be shown inline by the client, so anything
+				// the diagram source smuggled in must not run there.
+				_, span = telemetry.Start(ctx, "svgconv.Sanitize", trace.WithAttributes(
+					attribute.String("svgconv.policy", policyName),
+				))
+				sanitized, removed, err := svgconv.Sanitize(svgOut, policy)
+				telemetry.End(span, err)
+				if err != nil {
+					return nil, fmt.Errorf("rendered SVG could not be sanitized: %w; use format png for an image instead", err)
+				}
+				if len(removed) > 0 {
+					slog.Debug("Removed content from rendered SVG", "diagramType", diagramType, "policy", policyName, "removed", removed)
+				}
+				svgOut = sanitized
+			}
+			_, span = telemetry.Start(ctx, "svgconv.MinifySVG")
+			minified, err := svgconv.MinifySVG(svgOut)
+			telemetry.End(span, err)
+			if err == nil {
 				svgOut = minified
 			}
+			return []byte(svgOut), nil
+		})
+		if err != nil {
+			slog.Error("Failed to render diagram", "error", err)
+			return renderErrorResult(err), nil
+		}
+
+		switch model.OutputFormat(format) {
+		case model.PNG, model.JPEG, model.PDF, model.WEBP, model.AVIF:
+			return binaryResult(diagramType, model.OutputFormat(format), content), nil
+		case model.SVG:
+			svgOut := string(content)
 			if len(svgOut) > maxInlineSVGBytes {
 				slog.Error("Rendered SVG too large to return inline", "bytes", len(svgOut))
+				s.metrics.SVGTooLarge(diagramType)
 				return mcp.NewToolResultError(fmt.Sprintf(
 					"rendered SVG is %d bytes, too large to return inline; use get_diagram_url for a link or generate_png_diagram_with_custom_dpi for an image instead", len(svgOut))), nil
 			}
@@ -129,27 +608,27 @@ func (s *KrokiMCPServer) RegisterGenerateDiagramTool() {
 		default:
 			return mcp.NewToolResultError(fmt.Sprintf("Unsupported format: %s", format)), nil
 		}
-	})
+	}}
 }
 
 func (s *KrokiMCPServer) RegisterGetDiagramURLTool() {
+	s.mcp.AddTools(s.getDiagramURLTool())
+}
+
+func (s *KrokiMCPServer) getDiagramURLTool() server.ServerTool {
 	tool := mcp.NewTool("get_diagram_url",
 		mcp.WithDescription("Get a URL for a diagram image from textual code using Kroki."),
-		mcp.WithString("diagramType",
-			mcp.Required(),
-			mcp.Description("The diagram code syntax type (e.g., plantuml, mermaid, graphviz)"),
-			mcp.Enum(model.SupportedDiagramTypes...),
-		),
+		withDiagramType(s.diagramTypes()),
 		mcp.WithString("source",
 			mcp.Required(),
 			mcp.Description("The textual diagram source code"),
 		),
 		mcp.WithString("format",
-			mcp.Required(),
-			mcp.Description("Output media format: png or svg."),
-			mcp.Enum(model.SupportedOutputFormats...),
-			mcp.DefaultString("png"),
+			mcp.Description("Output media format: png, svg, jpeg or pdf, as Kroki renders the diagram type to it."),
+			mcp.Enum(urlFormats...),
+			mcp.DefaultString(s.defaultURLFormat()),
 		),
+		withDiagramOptions(),
 		mcp.WithToolAnnotation(mcp.ToolAnnotation{
 			Title:           "Generate diagram URL from source",
 			ReadOnlyHint:    mcp.ToBoolPtr(true),
@@ -159,13 +638,24 @@ func (s *KrokiMCPServer) RegisterGetDiagramURLTool() {
 		}),
 	)
 
-	s.mcp.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		diagramType, source, format, errResult := parseDiagramArgs(req, true)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		diagramType, source, format, errResult := s.parseDiagramArgs(req, s.defaultURLFormat())
+		if errResult == nil && !slices.Contains(urlFormats, format) {
+			slog.Error("Invalid format value for a URL", "format", format)
+			errResult = mcp.NewToolResultError("get_diagram_url links to " + strings.Join(urlFormats, ", ") + " only; use generate_diagram for " + format)
+		}
+		if errResult == nil {
+			errResult = checkFormat(diagramType, format, false)
+		}
+		if errResult != nil {
+			return errResult, nil
+		}
+		options, errResult := parseDiagramOptions(req, diagramType)
 		if errResult != nil {
 			return errResult, nil
 		}
 
-		rawURL, err := s.krokiClient.GetDiagramURL(diagramType, source, model.OutputFormat(format))
+		rawURL, err := s.KrokiClient().GetDiagramURLContext(ctx, diagramType, source, model.OutputFormat(format), options)
 		if err != nil {
 			slog.Error("Failed to get diagram URL", "error", err)
 			return mcp.NewToolResultError(err.Error()), nil
@@ -179,17 +669,17 @@ func (s *KrokiMCPServer) RegisterGetDiagramURLTool() {
 				},
 			},
 		}, nil
-	})
+	}}
 }
 
 func (s *KrokiMCPServer) RegisterGeneratePNGDiagramWithCustomDPITool() {
+	s.mcp.AddTools(s.generatePNGDiagramWithCustomDPITool())
+}
+
+func (s *KrokiMCPServer) generatePNGDiagramWithCustomDPITool() server.ServerTool {
 	tool := mcp.NewTool("generate_png_diagram_with_custom_dpi",
 		mcp.WithDescription("Generate a high-quality diagram (recommended: 150dpi for Claude Desktop) PNG image from textual code using Kroki."),
-		mcp.WithString("diagramType",
-			mcp.Required(),
-			mcp.Description("The diagram code syntax type (e.g., plantuml, mermaid, graphviz)"),
-			mcp.Enum(model.SupportedDiagramTypes...),
-		),
+		withDiagramType(s.diagramTypes()),
 		mcp.WithString("source",
 			mcp.Required(),
 			mcp.Description("The textual diagram source code"),
@@ -198,6 +688,14 @@ func (s *KrokiMCPServer) RegisterGeneratePNGDiagramWithCustomDPITool() {
 			mcp.Description("Output dots per inch (DPI) for the PNG image from 72 to 300"),
 			mcp.DefaultNumber(defaultDPI),
 		),
+		mcp.WithString("background",
+			mcp.Description("CSS color to flatten the PNG onto, e.g. white or #1e1e1e; the PNG keeps its transparency when omitted."),
+		),
+		mcp.WithString("theme",
+			mcp.Description("Adapt the diagram to a page theme: light removes its background, dark also turns black lines and text light and white fills dark."),
+			mcp.Enum(string(svgconv.ThemeLight), string(svgconv.ThemeDark)),
+		),
+		withDiagramOptions(),
 		mcp.WithToolAnnotation(mcp.ToolAnnotation{
 			Title:           "Generate high-DPI PNG diagram from source",
 			ReadOnlyHint:    mcp.ToBoolPtr(true),
@@ -207,8 +705,12 @@ func (s *KrokiMCPServer) RegisterGeneratePNGDiagramWithCustomDPITool() {
 		}),
 	)
 
-	s.mcp.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		diagramType, source, _, errResult := parseDiagramArgs(req, false)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		diagramType, source, _, errResult := s.parseDiagramArgs(req, "")
+		if errResult != nil {
+			return errResult, nil
+		}
+		options, errResult := parseDiagramOptions(req, diagramType)
 		if errResult != nil {
 			return errResult, nil
 		}
@@ -226,30 +728,94 @@ func (s *KrokiMCPServer) RegisterGeneratePNGDiagramWithCustomDPITool() {
 			slog.Error("Invalid DPI value", "dpi", dpi)
 			return mcp.NewToolResultError("DPI must be between 72 and 300"), nil
 		}
-
-		result, err := s.krokiClient.RenderDiagram(diagramType, source, model.OutputFormat(model.SVG))
-		if err != nil {
-			slog.Error("Failed to render high-quality diagram", "error", err)
-			return mcp.NewToolResultError(err.Error()), nil
+		conversion, errResult := parseConversionArgs(req, false)
+		if errResult != nil {
+			return errResult, nil
+		}
+		if conversion.theme == svgconv.ThemeAuto {
+			return mcp.NewToolResultError(themeAutoSVGOnly), nil
 		}
-		buf := &bytes.Buffer{}
-		err = svgconv.Convert(buf, string(result.ImageContent), svgconv.Options{
-			Format: svgconv.PNG,
-			DPI:    dpi,
+
+		key := cache.Key{DiagramType: diagramType, Source: source, Format: string(model.PNG), Options: options, DPI: dpi, PostProcess: postProcessRasterize, Background: conversion.background, Theme: string(conversion.theme)}
+		png, err := s.cachedRender(key, func(kc *kroki.KrokiClient) ([]byte, error) {
+			result, err := kc.RenderDiagramContext(ctx, diagramType, source, model.OutputFormat(model.SVG), options)
+			if err != nil {
+				slog.Error("Failed to render high-quality diagram", "error", err)
+				return nil, err
+			}
+			return s.convertSVG(ctx, result.ImageContent, model.PNG, dpi, conversion)
 		})
 		if err != nil {
-			slog.Error("Failed to convert SVG to PNG", "error", err)
-			return mcp.NewToolResultError(err.Error()), nil
+			return renderErrorResult(err), nil
 		}
-		data := base64.StdEncoding.EncodeToString(buf.Bytes())
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				mcp.ImageContent{
-					Type:     "image",
-					MIMEType: model.PNG.MIMEType(),
-					Data:     data,
-				},
-			},
-		}, nil
-	})
+		return binaryResult(diagramType, model.PNG, png), nil
+	}}
+}
+
+// validationFormat is the output format validate_diagram renders to. Every
+// engine Kroki fronts produces SVG natively, and it is the cheapest output
+// to produce and discard: no rasterization, on Kroki's side or ours.
+const validationFormat = model.SVG
+
+// validationResult is the structured content of a validate_diagram call.
+// Diagnostics is set only when Valid is false.
+type validationResult struct {
+	Valid       bool                 `json:"valid"`
+	Diagnostics []*kroki.RenderError `json:"diagnostics,omitempty"`
+}
+
+func (s *KrokiMCPServer) RegisterValidateDiagramTool() {
+	s.mcp.AddTools(s.validateDiagramTool())
+}
+
+func (s *KrokiMCPServer) validateDiagramTool() server.ServerTool {
+	tool := mcp.NewTool("validate_diagram",
+		mcp.WithDescription("Check whether a diagram source compiles with Kroki without returning an image. Returns valid: true, or diagnostics with the engine's message and the line/column at fault. Use it to iterate cheaply before the final render."),
+		withDiagramType(s.diagramTypes()),
+		mcp.WithString("source",
+			mcp.Required(),
+			mcp.Description("The textual diagram source code"),
+		),
+		withDiagramOptions(),
+		mcp.WithOutputSchema[validationResult](),
+		mcp.WithToolAnnotation(mcp.ToolAnnotation{
+			Title:           "Validate diagram source",
+			ReadOnlyHint:    mcp.ToBoolPtr(true),
+			DestructiveHint: mcp.ToBoolPtr(false),
+			IdempotentHint:  mcp.ToBoolPtr(true),
+			OpenWorldHint:   mcp.ToBoolPtr(true),
+		}),
+	)
+
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		diagramType, source, _, errResult := s.parseDiagramArgs(req, "")
+		if errResult != nil {
+			return errResult, nil
+		}
+		options, errResult := parseDiagramOptions(req, diagramType)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		_, err := s.KrokiClient().RenderDiagramContext(ctx, diagramType, source, validationFormat, options)
+		if err == nil {
+			return mcp.NewToolResultStructured(validationResult{Valid: true}, "valid: the diagram source compiles"), nil
+		}
+
+		// A 400 or 422 is Kroki rejecting the source, which is the answer
+		// to the question asked; anything else, including a 429 rate limit
+		// or a 404, means the check itself failed and says nothing about the
+		// source.
+		var renderErr *kroki.RenderError
+		if !errors.As(err, &renderErr) || (renderErr.StatusCode != http.StatusBadRequest && renderErr.StatusCode != http.StatusUnprocessableEntity) {
+			slog.Error("Failed to validate diagram", "error", err)
+			return renderErrorResult(err), nil
+		}
+		slog.Debug("Diagram source is invalid", "diagramType", diagramType, "message", renderErr.Message,
+			"line", renderErr.Line, "column", renderErr.Column)
+		return mcp.NewToolResultStructured(
+			validationResult{Diagnostics: []*kroki.RenderError{renderErr}},
+			"invalid: "+strings.TrimPrefix(renderErr.Error(), "kroki error: "),
+		), nil
+	}}
 }
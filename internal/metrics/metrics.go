@@ -0,0 +1,173 @@
+// Package metrics exposes Prometheus metrics for tool calls, Kroki
+// requests, the render cache and local SVG conversion.
+//
+// A nil *Metrics is valid and records nothing, so instrumented code does
+// not need to check whether metrics are enabled.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kroki_mcp"
+
+// Metrics holds the collectors, registered on a registry of its own so
+// tests and multiple servers in one process do not collide.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	toolCalls          *prometheus.CounterVec
+	toolDuration       *prometheus.HistogramVec
+	toolResponseBytes  *prometheus.HistogramVec
+	svgTooLarge        *prometheus.CounterVec
+	krokiRequests      *prometheus.CounterVec
+	krokiDuration      *prometheus.HistogramVec
+	conversionDuration *prometheus.HistogramVec
+	cacheLookups       *prometheus.CounterVec
+	activeSessions     prometheus.Gauge
+}
+
+// New returns Metrics with the Go runtime and process collectors
+// registered next to ours.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tool_calls_total",
+			Help:      "Tool calls by tool, diagram type, output format and outcome (ok or error).",
+		}, []string{"tool", "diagram_type", "format", "outcome"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tool_call_duration_seconds",
+			Help:      "Tool call latency, including Kroki requests and local post-processing.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"tool", "diagram_type", "format"}),
+		toolResponseBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tool_response_bytes",
+			Help:      "Size of successful tool results: decoded image bytes or text length.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 9), // 256 B to 16 MiB
+		}, []string{"tool", "diagram_type", "format"}),
+		svgTooLarge: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "svg_too_large_total",
+			Help:      "generate_diagram SVG results rejected for exceeding the inline size limit.",
+		}, []string{"diagram_type"}),
+		krokiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "kroki_requests_total",
+			Help:      "Requests to Kroki backends by HTTP status code; 0 is a request that got no response.",
+		}, []string{"backend", "code"}),
+		krokiDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "kroki_request_duration_seconds",
+			Help:      "Latency of single requests to Kroki backends, retries counted separately.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"backend"}),
+		conversionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "svg_conversion_duration_seconds",
+			Help:      "Time spent converting SVG to raster formats locally (svgconv.Convert).",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"format"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "render_cache_lookups_total",
+			Help:      "Render cache lookups by result (hit or miss).",
+		}, []string{"result"}),
+		activeSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "MCP client sessions currently connected.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.toolCalls, m.toolDuration, m.toolResponseBytes, m.svgTooLarge,
+		m.krokiRequests, m.krokiDuration, m.conversionDuration,
+		m.cacheLookups, m.activeSessions,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ToolCall records a finished tool call. bytes is ignored for failed calls.
+func (m *Metrics) ToolCall(tool, diagramType, format string, failed bool, elapsed time.Duration, bytes int) {
+	if m == nil {
+		return
+	}
+	outcome := "ok"
+	if failed {
+		outcome = "error"
+	}
+	m.toolCalls.WithLabelValues(tool, diagramType, format, outcome).Inc()
+	m.toolDuration.WithLabelValues(tool, diagramType, format).Observe(elapsed.Seconds())
+	if !failed {
+		m.toolResponseBytes.WithLabelValues(tool, diagramType, format).Observe(float64(bytes))
+	}
+}
+
+// SVGTooLarge records an SVG result rejected by the inline size limit.
+func (m *Metrics) SVGTooLarge(diagramType string) {
+	if m == nil {
+		return
+	}
+	m.svgTooLarge.WithLabelValues(diagramType).Inc()
+}
+
+// KrokiRequest records one request to a Kroki backend; statusCode is 0
+// when no response arrived. Its signature matches kroki.RequestObserver.
+func (m *Metrics) KrokiRequest(backend string, statusCode int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.krokiRequests.WithLabelValues(backend, strconv.Itoa(statusCode)).Inc()
+	m.krokiDuration.WithLabelValues(backend).Observe(elapsed.Seconds())
+}
+
+// Conversion records a local SVG conversion to format.
+func (m *Metrics) Conversion(format string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.conversionDuration.WithLabelValues(format).Observe(elapsed.Seconds())
+}
+
+// CacheLookup records a render cache hit or miss.
+func (m *Metrics) CacheLookup(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+// SessionOpened and SessionClosed track the connected MCP sessions.
+func (m *Metrics) SessionOpened() {
+	if m == nil {
+		return
+	}
+	m.activeSessions.Inc()
+}
+
+func (m *Metrics) SessionClosed() {
+	if m == nil {
+		return
+	}
+	m.activeSessions.Dec()
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetrics_Exposition(t *testing.T) {
+	m := New()
+	m.ToolCall("generate_diagram", "plantuml", "svg", false, 50*time.Millisecond, 1024)
+	m.ToolCall("generate_diagram", "plantuml", "svg", true, time.Second, 0)
+	m.SVGTooLarge("graphviz")
+	m.KrokiRequest("https://kroki.io", 0, time.Second)
+	m.SessionOpened()
+	m.SessionOpened()
+	m.SessionClosed()
+
+	exposition := scrape(t, m)
+	for _, want := range []string{
+		`kroki_mcp_tool_calls_total{diagram_type="plantuml",format="svg",outcome="ok",tool="generate_diagram"} 1`,
+		`kroki_mcp_tool_calls_total{diagram_type="plantuml",format="svg",outcome="error",tool="generate_diagram"} 1`,
+		`kroki_mcp_tool_call_duration_seconds_count{diagram_type="plantuml",format="svg",tool="generate_diagram"} 2`,
+		// Failed calls have no response size.
+		`kroki_mcp_tool_response_bytes_count{diagram_type="plantuml",format="svg",tool="generate_diagram"} 1`,
+		`kroki_mcp_svg_too_large_total{diagram_type="graphviz"} 1`,
+		`kroki_mcp_kroki_requests_total{backend="https://kroki.io",code="0"} 1`,
+		`kroki_mcp_active_sessions 1`,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("exposition does not contain %s", want)
+		}
+	}
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.ToolCall("generate_diagram", "plantuml", "svg", false, time.Millisecond, 1)
+	m.SVGTooLarge("plantuml")
+	m.KrokiRequest("https://kroki.io", 200, time.Millisecond)
+	m.Conversion("png", time.Millisecond)
+	m.CacheLookup(true)
+	m.SessionOpened()
+	m.SessionClosed()
+}
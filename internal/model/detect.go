@@ -0,0 +1,143 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+)
+
+// AutoDiagramType asks the tools to detect the diagram type from the
+// source, as omitting the type does.
+const AutoDiagramType = "auto"
+
+var (
+	plantumlStart = regexp.MustCompile(`(?m)^\s*@start(uml|mindmap|gantt|wbs|salt|json|yaml|ebnf|regex|chen|chronology|files|board)\b`)
+	c4Include     = regexp.MustCompile(`(?mi)^\s*!include(url)?\s+\S*C4[-_/]`)
+
+	bpmnNamespace = regexp.MustCompile(`http://www\.omg\.org/spec/BPMN/|<(bpmn2?:)?definitions\b[^>]*bpmn`)
+	umletDiagram  = regexp.MustCompile(`<diagram\s+program="umlet"|<umlet_diagram>`)
+
+	vegaLiteSchema = regexp.MustCompile(`"\$schema"\s*:\s*"[^"]*vega-lite`)
+	vegaSchema     = regexp.MustCompile(`"\$schema"\s*:\s*"[^"]*/schema/vega/`)
+	excalidrawType = regexp.MustCompile(`"type"\s*:\s*"excalidraw"`)
+	wavedromRoot   = regexp.MustCompile(`^\{\s*"?(signal|reg|assign)"?\s*:`)
+
+	mermaidFrontMatter = regexp.MustCompile(`(?s)^---\n.*?\n---\s*\n`)
+	mermaidFlowchart   = regexp.MustCompile(`^(graph|flowchart)(\s+(TB|TD|BT|RL|LR))?\s*(;|$)`)
+	mermaidDiagram     = regexp.MustCompile(`^(sequenceDiagram|classDiagram(-v2)?|stateDiagram(-v2)?|erDiagram|journey|gantt|pie|gitGraph|mindmap|timeline|quadrantChart|requirementDiagram|C4Context|C4Container|C4Component|C4Dynamic|C4Deployment|sankey-beta|xychart-beta|block-beta|packet-beta|architecture-beta|kanban|radar-beta)\b`)
+
+	dotGraph         = regexp.MustCompile(`^(strict\s+)?(di)?graph\b[^{;]*\{`)
+	blockdiagGraph   = regexp.MustCompile(`^(blockdiag|seqdiag|nwdiag|packetdiag|rackdiag)\b[^{]*\{`)
+	structurizrDSL   = regexp.MustCompile(`^workspace\b`)
+	bytefieldDraw    = regexp.MustCompile(`\(draw-(box|boxes|column-headers|row-header|gap|bottom)\b`)
+	dbmlTable        = regexp.MustCompile(`(?mi)^\s*Table\s+[\w".]+(\s+as\s+\w+)?\s*(\[[^\]]*\])?\s*\{`)
+	erdRelation      = regexp.MustCompile(`(?m)^\s*[\w"]+\s+[?1*+]--[?1*+]\s+[\w"]+\s*$`)
+	nomnomlEdge      = regexp.MustCompile(`(?m)^\s*\[[^\]]+\]\s*[-<o+:]*-+[>o+]?\s*\[`)
+	nomnomlDirective = regexp.MustCompile(`(?m)^#(direction|fill|stroke|ranker|arrowSize|spacing|padding)\s*:`)
+)
+
+// DetectDiagramType guesses the diagram type of source from syntax that
+// gives it away, such as @startuml, a digraph block, a Mermaid diagram
+// keyword, a Vega $schema or BPMN XML. It returns "" when nothing is
+// conclusive, which includes the ASCII-art types (ditaa, svgbob) and
+// free-form ones (d2, pikchr). PlantUML sources including the C4 library are
+// reported as c4plantuml.
+func DetectDiagramType(source string) string {
+	s := strings.TrimSpace(strings.TrimPrefix(source, "\ufeff"))
+	switch {
+	case s == "":
+		return ""
+	case plantumlStart.MatchString(s):
+		if c4Include.MatchString(s) {
+			return "c4plantuml"
+		}
+		return "plantuml"
+	case strings.HasPrefix(s, "<"):
+		switch {
+		case bpmnNamespace.MatchString(s):
+			return "bpmn"
+		case umletDiagram.MatchString(s):
+			return "umlet"
+		}
+		return ""
+	case strings.HasPrefix(s, "{"):
+		switch {
+		case vegaLiteSchema.MatchString(s):
+			return "vegalite"
+		case vegaSchema.MatchString(s):
+			return "vega"
+		case excalidrawType.MatchString(s):
+			return "excalidraw"
+		case wavedromRoot.MatchString(s):
+			return "wavedrom"
+		}
+		return ""
+	}
+
+	if body := mermaidFrontMatter.ReplaceAllString(s+"\n", ""); body != s+"\n" || strings.HasPrefix(s, "%%") {
+		// Front matter and %% directives or comments are Mermaid's own.
+		if line := firstLine(body, "%%"); mermaidFlowchart.MatchString(line) || mermaidDiagram.MatchString(line) {
+			return "mermaid"
+		}
+	}
+	code := skipComments(s)
+	line := firstLine(code, "")
+	switch {
+	case dotGraph.MatchString(code):
+		return "graphviz"
+	case mermaidFlowchart.MatchString(line) || mermaidDiagram.MatchString(line):
+		return "mermaid"
+	}
+	if m := blockdiagGraph.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	switch {
+	case structurizrDSL.MatchString(code):
+		return "structurizr"
+	case bytefieldDraw.MatchString(s):
+		return "bytefield"
+	case dbmlTable.MatchString(s):
+		return "dbml"
+	case erdRelation.MatchString(s):
+		return "erd"
+	case nomnomlEdge.MatchString(s) || nomnomlDirective.MatchString(s):
+		return "nomnoml"
+	}
+	return ""
+}
+
+// firstLine returns the first non-blank line of s, trimmed, skipping lines
+// starting with commentPrefix when it is not empty.
+func firstLine(s, commentPrefix string) string {
+	for line := range strings.Lines(s) {
+		line = strings.TrimSpace(line)
+		if line == "" || (commentPrefix != "" && strings.HasPrefix(line, commentPrefix)) {
+			continue
+		}
+		return line
+	}
+	return ""
+}
+
+// skipComments drops the blank lines and the //, # and /* */ comments
+// leading s, as DOT, the blockdiag family and Structurizr allow.
+func skipComments(s string) string {
+	for {
+		s = strings.TrimSpace(s)
+		switch {
+		case strings.HasPrefix(s, "//"), strings.HasPrefix(s, "#"):
+			_, rest, ok := strings.Cut(s, "\n")
+			if !ok {
+				return ""
+			}
+			s = rest
+		case strings.HasPrefix(s, "/*"):
+			_, rest, ok := strings.Cut(s, "*/")
+			if !ok {
+				return ""
+			}
+			s = rest
+		default:
+			return s
+		}
+	}
+}
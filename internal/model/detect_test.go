@@ -0,0 +1,97 @@
+package model
+
+import "testing"
+
+// Each type has a source that gives it away and a near miss that must not be
+// mistaken for it.
+func TestDetectDiagramType(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{name: "plantuml", source: "@startuml\nAlice -> Bob: hi\n@enduml", want: "plantuml"},
+		{name: "plantuml indented with BOM", source: "\ufeff  @startmindmap\n* root\n@endmindmap", want: "plantuml"},
+		{name: "plantuml gantt", source: "@startgantt\n[Task] lasts 5 days\n@endgantt", want: "plantuml"},
+		{name: "plantuml mentioned in a comment", source: "# see @startuml docs\n"},
+		{name: "c4plantuml", source: "@startuml\n!include <C4/C4_Container>\nPerson(user, \"User\")\n@enduml", want: "c4plantuml"},
+		{name: "c4plantuml by URL", source: "@startuml\n!includeurl https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Context.puml\n@enduml", want: "c4plantuml"},
+		{name: "plantuml with another include", source: "@startuml\n!include <tupadr3/common>\n@enduml", want: "plantuml"},
+
+		{name: "bpmn", source: `<?xml version="1.0"?><bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL"></bpmn:definitions>`, want: "bpmn"},
+		{name: "umlet", source: `<?xml version="1.0"?><diagram program="umlet" version="14.3.0"></diagram>`, want: "umlet"},
+		{name: "other XML", source: `<diagram program="drawio"><mxGraphModel/></diagram>`},
+
+		{name: "vegalite", source: `{"$schema": "https://vega.github.io/schema/vega-lite/v5.json", "mark": "bar"}`, want: "vegalite"},
+		{name: "vega", source: `{"$schema": "https://vega.github.io/schema/vega/v5.json", "marks": []}`, want: "vega"},
+		{name: "excalidraw", source: `{"type": "excalidraw", "version": 2, "elements": []}`, want: "excalidraw"},
+		{name: "wavedrom", source: `{ signal: [{ name: "clk", wave: "p...." }] }`, want: "wavedrom"},
+		{name: "wavedrom register", source: `{"reg": [{"bits": 8, "name": "a"}]}`, want: "wavedrom"},
+		{name: "JSON without a schema", source: `{"signals": [], "data": {"values": []}}`},
+
+		{name: "mermaid flowchart", source: "flowchart LR\n  A --> B", want: "mermaid"},
+		{name: "mermaid graph TD", source: "graph TD\n  A-->B", want: "mermaid"},
+		{name: "mermaid graph LR;", source: "graph LR; A-->B;", want: "mermaid"},
+		{name: "mermaid front matter", source: "---\ntitle: Flow\n---\nflowchart LR\n  A --> B", want: "mermaid"},
+		{name: "mermaid %% comment", source: "%% a comment\nsequenceDiagram\n  A->>B: hi", want: "mermaid"},
+		{name: "mermaid %%{init}%% directive", source: "%%{init: {'theme': 'dark'}}%%\nclassDiagram\n  A <|-- B", want: "mermaid"},
+		{name: "mermaid gantt", source: "gantt\n  title Plan\n  section A\n  Task :a1, 2024-01-01, 3d", want: "mermaid"},
+		{name: "front matter without a diagram", source: "---\ntitle: Notes\n---\nsome prose"},
+
+		{name: "graphviz digraph", source: "digraph G { a -> b }", want: "graphviz"},
+		{name: "graphviz graph", source: "graph { a -- b }", want: "graphviz"},
+		{name: "graphviz strict after comments", source: "// deps\n/* generated */\n# note\nstrict digraph { a -> b }", want: "graphviz"},
+		{name: "graphviz word in prose", source: "a graph of things"},
+
+		{name: "blockdiag", source: "blockdiag {\n  A -> B;\n}", want: "blockdiag"},
+		{name: "seqdiag", source: "seqdiag {\n  browser -> webserver;\n}", want: "seqdiag"},
+		{name: "nwdiag", source: "nwdiag {\n  network dmz { web01; }\n}", want: "nwdiag"},
+		{name: "packetdiag", source: "packetdiag {\n  0-15: Source Port\n}", want: "packetdiag"},
+		{name: "rackdiag", source: "// rack\nrackdiag {\n  16U;\n}", want: "rackdiag"},
+		{name: "blockdiag prefix of another word", source: "blockdiagram {\n}"},
+
+		{name: "structurizr", source: "workspace {\n  model {\n    user = person \"User\"\n  }\n}", want: "structurizr"},
+		{name: "structurizr plural", source: "workspaces {\n}"},
+
+		{name: "bytefield", source: "(draw-column-headers)\n(draw-box \"Address\" {:span 4})", want: "bytefield"},
+		{name: "bytefield other call", source: "(draw-circle 1)"},
+
+		{name: "dbml", source: "Table users {\n  id integer [pk]\n}", want: "dbml"},
+		{name: "dbml with alias and settings", source: "Table public.users as U [headercolor: #3498DB] {\n  id int\n}", want: "dbml"},
+		{name: "dbml prose", source: "Table of contents {\n}"},
+
+		{name: "erd", source: "[Person]\n*name\n\n[Location]\ncity\n\nPerson *--1 Location", want: "erd"},
+		{name: "erd without cardinalities", source: "Person -- Location"},
+
+		{name: "nomnoml edge", source: "[Customer] -> [Order]", want: "nomnoml"},
+		{name: "nomnoml directive", source: "#direction: right\n[A]", want: "nomnoml"},
+		{name: "nomnoml-like boxes without edges", source: "[A]\n[B]"},
+
+		{name: "d2", source: "x -> y: hello"},
+		{name: "ditaa", source: "+--------+\n| cBLU   |\n+--------+"},
+		{name: "svgbob", source: "  .---.\n  |   |\n  '---'"},
+		{name: "pikchr", source: "box \"Hello\"\narrow\nbox \"World\""},
+		{name: "empty", source: "  \n"},
+	}
+	for _, tt := range tests {
+		if got := DetectDiagramType(tt.source); got != tt.want {
+			t.Errorf("%s: DetectDiagramType(%q) = %q, want %q", tt.name, tt.source, got, tt.want)
+		}
+	}
+}
+
+// Every registry example must be detected as its own type, except those of
+// the types DetectDiagramType leaves undetected.
+func TestDetectDiagramType_RegistryExamples(t *testing.T) {
+	undetected := map[string]bool{"d2": true, "ditaa": true, "pikchr": true, "svgbob": true}
+	for _, diagram := range Diagrams.Types() {
+		got := DetectDiagramType(diagram.Example)
+		want := diagram.Name
+		if undetected[diagram.Name] {
+			want = ""
+		}
+		if got != want {
+			t.Errorf("%s example detected as %q, want %q:\n%s", diagram.Name, got, want, diagram.Example)
+		}
+	}
+}
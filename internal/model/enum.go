@@ -1,20 +1,35 @@
 package model
 
+import "slices"
+
 // Enum types for various diagram formats and output formats
 // and their corresponding MIME types.
 //
-//	Must be one of png, svg
+// The tools accept the formats in SupportedOutputFormats, rendered by Kroki
+// when the registry lists the format for the diagram type and converted
+// locally from SVG otherwise. TEXT asks for the diagram as text art, which
+// Kroki renders as TXT (ASCII) or UTXT (Unicode) for the types the registry
+// lists them for. WEBP and AVIF are supported only by builds with the
+// "formats" build tag.
 type OutputFormat string
 
 const (
-	PNG OutputFormat = "png"
-	SVG OutputFormat = "svg"
+	PNG  OutputFormat = "png"
+	SVG  OutputFormat = "svg"
+	JPEG OutputFormat = "jpeg"
+	PDF  OutputFormat = "pdf"
+	TXT  OutputFormat = "txt"
+	UTXT OutputFormat = "utxt"
+	TEXT OutputFormat = "text"
+	WEBP OutputFormat = "webp"
+	AVIF OutputFormat = "avif"
 )
 
-var SupportedOutputFormats = []string{
-	string(PNG),
-	string(SVG),
-}
+var SupportedOutputFormats = slices.Concat(
+	[]string{string(PNG), string(SVG), string(JPEG), string(PDF)},
+	encodedFormats,
+	[]string{string(TEXT)},
+)
 
 func (f OutputFormat) MIMEType() string {
 	switch f {
@@ -22,18 +37,19 @@ func (f OutputFormat) MIMEType() string {
 		return "image/svg+xml"
 	case PNG:
 		return "image/png"
+	case JPEG:
+		return "image/jpeg"
+	case PDF:
+		return "application/pdf"
+	case WEBP:
+		return "image/webp"
+	case AVIF:
+		return "image/avif"
 	default:
 		return "text/plain"
 	}
 }
 
-var SupportedDiagramTypes = []string{
-	"blockdiag", "bpmn", "bytefield", "c4plantuml", "d2", "dbml", "ditaa", "erd",
-	"excalidraw", "graphviz", "mermaid", "nomnoml", "nwdiag", "packetdiag",
-	"pikchr", "plantuml", "rackdiag", "seqdiag", "structurizr", "svgbob", "umlet",
-	"vega", "vegalite", "wavedrom",
-}
-
 var RecommendedDPIList = []float64{
 	72, 84, 96, 120, 144, 150, 166, 180, 200, 220, 240,
 }
@@ -0,0 +1,7 @@
+//go:build formats
+
+package model
+
+// encodedFormats are the output formats this build encodes with libwebp and
+// libaom, linked by the canvas library with the "formats" build tag.
+var encodedFormats = []string{string(WEBP), string(AVIF)}
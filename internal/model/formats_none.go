@@ -0,0 +1,8 @@
+//go:build !formats
+
+package model
+
+// encodedFormats is empty without the "formats" build tag: the canvas
+// library then cannot encode WebP or AVIF, and Kroki renders neither for
+// any diagram type.
+var encodedFormats []string
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DiagramOption describes one Kroki diagram option a diagram type accepts.
+type DiagramOption struct {
+	// Name is the option name as Kroki expects it. A trailing "*" makes it
+	// a prefix: graphviz's "graph-attribute-*" accepts
+	// "graph-attribute-rankdir", "graph-attribute-bgcolor", and so on.
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Values lists the accepted values; empty means any value.
+	Values []string `json:"values,omitempty"`
+}
+
+// matches reports whether name is this option or, for a prefix option, one
+// of its family.
+func (o DiagramOption) matches(name string) bool {
+	if prefix, ok := strings.CutSuffix(o.Name, "*"); ok {
+		return strings.HasPrefix(name, prefix) && len(name) > len(prefix)
+	}
+	return name == o.Name
+}
+
+var boolValues = []string{"true", "false"}
+
+var blockdiagOptions = []DiagramOption{
+	{Name: "antialias", Description: "Smooth shapes and lines in raster output", Values: boolValues},
+	{Name: "no-transparency", Description: "Paint an opaque background", Values: boolValues},
+}
+
+var plantumlOptions = []DiagramOption{
+	{Name: "theme", Description: "PlantUML theme, e.g. cerulean, sketchy-outline, spacelab"},
+	{Name: "no-metadata", Description: "Omit the diagram source from the output metadata", Values: boolValues},
+	{Name: "no-transparency", Description: "Paint an opaque background", Values: boolValues},
+}
+
+var d2Options = []DiagramOption{
+	{Name: "theme", Description: "D2 theme ID, e.g. 0 (default), 1 (neutral grey), 200 (dark mauve)"},
+	{Name: "layout", Description: "Layout engine", Values: []string{"dagre", "elk"}},
+	{Name: "sketch", Description: "Render in a hand-drawn style", Values: boolValues},
+}
+
+var ditaaOptions = []DiagramOption{
+	{Name: "no-antialias", Description: "Disable anti-aliasing", Values: boolValues},
+	{Name: "no-separation", Description: "Do not separate common edges of shapes", Values: boolValues},
+	{Name: "no-shadows", Description: "Disable drop shadows", Values: boolValues},
+	{Name: "round-corners", Description: "Round the corners of all boxes", Values: boolValues},
+	{Name: "scale", Description: "Scale factor, e.g. 1.5"},
+	{Name: "transparent", Description: "Transparent background", Values: boolValues},
+}
+
+var graphvizOptions = []DiagramOption{
+	{Name: "layout", Description: "Layout engine", Values: []string{"dot", "neato", "fdp", "sfdp", "twopi", "circo", "osage", "patchwork"}},
+	{Name: "graph-attribute-*", Description: "Graph attribute default, e.g. graph-attribute-rankdir=LR"},
+	{Name: "node-attribute-*", Description: "Node attribute default, e.g. node-attribute-shape=box"},
+	{Name: "edge-attribute-*", Description: "Edge attribute default, e.g. edge-attribute-color=red"},
+}
+
+var mermaidOptions = []DiagramOption{
+	{Name: "theme", Description: "Mermaid theme", Values: []string{"default", "neutral", "dark", "forest", "base"}},
+	{Name: "look", Description: "Rendering style", Values: []string{"classic", "handDrawn"}},
+}
+
+var structurizrOptions = []DiagramOption{
+	{Name: "view-key", Description: "Key of the view to render"},
+}
+
+var svgbobOptions = []DiagramOption{
+	{Name: "background", Description: "Background color, e.g. white or transparent"},
+	{Name: "fill-color", Description: "Fill color of solid shapes"},
+	{Name: "font-family", Description: "Text font family"},
+	{Name: "font-size", Description: "Text font size"},
+	{Name: "scale", Description: "Scale factor"},
+	{Name: "stroke-width", Description: "Line width"},
+}
+
+// ValidateDiagramOptions checks options against the options the registry
+// lists for diagramType, returning an error naming the first unknown option or
+// disallowed value, in option-name order.
+func ValidateDiagramOptions(diagramType string, options map[string]string) error {
+	if len(options) == 0 {
+		return nil
+	}
+	diagram, _ := Diagrams.Lookup(diagramType)
+	catalog := diagram.Options
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		i := slices.IndexFunc(catalog, func(o DiagramOption) bool { return o.matches(name) })
+		if i < 0 {
+			if len(catalog) == 0 {
+				return fmt.Errorf("diagram type %s accepts no options, got %q", diagramType, name)
+			}
+			return fmt.Errorf("unknown option %q for diagram type %s; supported: %s", name, diagramType, optionNames(catalog))
+		}
+		if values := catalog[i].Values; len(values) > 0 && !slices.Contains(values, options[name]) {
+			return fmt.Errorf("invalid value %q for option %q; must be one of: %s", options[name], name, strings.Join(values, ", "))
+		}
+	}
+	return nil
+}
+
+func optionNames(catalog []DiagramOption) string {
+	names := make([]string, len(catalog))
+	for i, o := range catalog {
+		names[i] = o.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDiagramOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		diagramType string
+		options     map[string]string
+		wantErr     string
+	}{
+		{name: "no options", diagramType: "wavedrom"},
+		{name: "enumerated value", diagramType: "mermaid", options: map[string]string{"theme": "dark"}},
+		{name: "free-form value", diagramType: "d2", options: map[string]string{"theme": "200", "sketch": "true"}},
+		{name: "alias", diagramType: "dot", options: map[string]string{"layout": "neato"}},
+		{name: "prefix option", diagramType: "graphviz", options: map[string]string{"graph-attribute-rankdir": "LR"}},
+		{name: "bare prefix", diagramType: "graphviz", options: map[string]string{"graph-attribute-": "LR"}, wantErr: `unknown option "graph-attribute-"`},
+		{name: "unknown option", diagramType: "mermaid", options: map[string]string{"layout": "elk"}, wantErr: `unknown option "layout" for diagram type mermaid`},
+		{name: "disallowed value", diagramType: "graphviz", options: map[string]string{"layout": "spring"}, wantErr: `invalid value "spring" for option "layout"`},
+		{name: "type without options", diagramType: "wavedrom", options: map[string]string{"theme": "dark"}, wantErr: "accepts no options"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDiagramOptions(tt.diagramType, tt.options)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
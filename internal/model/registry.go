@@ -0,0 +1,326 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DiagramType describes a diagram type Kroki renders.
+type DiagramType struct {
+	// Name is the type as Kroki names it in the request.
+	Name string `json:"name"`
+	// Aliases are other names the tools accept for the type, e.g. dot for
+	// graphviz. They are resolved locally and never sent to Kroki.
+	Aliases []string `json:"aliases,omitempty"`
+	// OutputFormats lists the formats Kroki renders the type to.
+	OutputFormats []OutputFormat `json:"outputFormats"`
+	// FileExtensions lists the extensions source files of the type use,
+	// with the leading dot.
+	FileExtensions []string `json:"fileExtensions"`
+	// Companion reports that Kroki renders the type in a companion
+	// container, which self-hosted deployments may leave out; the server
+	// only renders the other types itself.
+	Companion bool `json:"companion,omitempty"`
+	// Options lists the Kroki diagram options the type accepts.
+	Options          []DiagramOption `json:"options,omitempty"`
+	DocumentationURL string          `json:"documentationUrl"`
+	// Example is a small source that renders.
+	Example string `json:"example"`
+}
+
+// SupportsFormat reports whether Kroki renders the type to format. TEXT is
+// supported by the types Kroki renders to TXT.
+func (t DiagramType) SupportsFormat(format OutputFormat) bool {
+	if format == TEXT {
+		return t.SupportsFormat(TXT)
+	}
+	return slices.Contains(t.OutputFormats, format)
+}
+
+// DiagramRegistry looks diagram types up by name or alias.
+type DiagramRegistry struct {
+	types []DiagramType
+	index map[string]int
+}
+
+// NewDiagramRegistry returns a registry of types, in that order. It panics
+// when two types share a name or alias.
+func NewDiagramRegistry(types ...DiagramType) *DiagramRegistry {
+	r := &DiagramRegistry{types: types, index: make(map[string]int)}
+	for i, t := range types {
+		for _, name := range append([]string{t.Name}, t.Aliases...) {
+			if _, dup := r.index[name]; dup {
+				panic(fmt.Sprintf("model: diagram type name %q registered twice", name))
+			}
+			r.index[name] = i
+		}
+	}
+	return r
+}
+
+// Lookup returns the type named name, or having it as an alias, ignoring
+// case.
+func (r *DiagramRegistry) Lookup(name string) (DiagramType, bool) {
+	i, ok := r.index[strings.ToLower(name)]
+	if !ok {
+		return DiagramType{}, false
+	}
+	return r.types[i], true
+}
+
+// Names returns the names of the registered types, without aliases.
+func (r *DiagramRegistry) Names() []string {
+	names := make([]string, len(r.types))
+	for i, t := range r.types {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Types returns the registered types.
+func (r *DiagramRegistry) Types() []DiagramType {
+	return slices.Clone(r.types)
+}
+
+// CheckFormat returns an error unless name is a registered type that Kroki
+// renders to format.
+func (r *DiagramRegistry) CheckFormat(name string, format OutputFormat) error {
+	t, ok := r.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown diagram type %q", name)
+	}
+	if !t.SupportsFormat(format) {
+		formats := make([]string, len(t.OutputFormats))
+		for i, f := range t.OutputFormats {
+			formats[i] = string(f)
+		}
+		err := fmt.Errorf("diagram type %s cannot be rendered as %s; it supports: %s", t.Name, format, strings.Join(formats, ", "))
+		if format == TEXT {
+			err = fmt.Errorf("%w; text output is available for: %s", err, strings.Join(r.TextTypes(), ", "))
+		}
+		return err
+	}
+	return nil
+}
+
+// TextTypes returns the names of the types with text output.
+func (r *DiagramRegistry) TextTypes() []string {
+	var names []string
+	for _, t := range r.types {
+		if t.SupportsFormat(TEXT) {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+var (
+	rasterVectorPDF = []OutputFormat{PNG, SVG, PDF}
+	svgOnly         = []OutputFormat{SVG}
+	plantumlFormats = []OutputFormat{PNG, SVG, PDF, TXT, UTXT}
+)
+
+// Diagrams is the registry of the diagram types the server supports. The
+// output formats follow Kroki's support matrix.
+var Diagrams = NewDiagramRegistry(
+	DiagramType{
+		Name:             "blockdiag",
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".blockdiag", ".diag"},
+		Options:          blockdiagOptions,
+		DocumentationURL: "http://blockdiag.com/en/blockdiag/",
+		Example:          "blockdiag {\n  Kroki -> generates -> \"Block diagrams\";\n}",
+	},
+	DiagramType{
+		Name:             "bpmn",
+		Companion:        true,
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".bpmn"},
+		DocumentationURL: "https://www.omg.org/spec/BPMN/2.0.2/",
+		Example: `<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:bpmndi="http://www.omg.org/spec/BPMN/20100524/DI" xmlns:dc="http://www.omg.org/spec/DD/20100524/DC" id="definitions" targetNamespace="http://bpmn.io/schema/bpmn">
+  <process id="process" isExecutable="false">
+    <startEvent id="start" />
+  </process>
+  <bpmndi:BPMNDiagram id="diagram">
+    <bpmndi:BPMNPlane id="plane" bpmnElement="process">
+      <bpmndi:BPMNShape id="start_di" bpmnElement="start">
+        <dc:Bounds x="100" y="100" width="36" height="36" />
+      </bpmndi:BPMNShape>
+    </bpmndi:BPMNPlane>
+  </bpmndi:BPMNDiagram>
+</definitions>`,
+	},
+	DiagramType{
+		Name:             "bytefield",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".bytefield"},
+		DocumentationURL: "https://bytefield-svg.deepsymmetry.org/",
+		Example:          "(draw-column-headers)\n(draw-box \"Address\" {:span 4})\n(draw-box \"Size\" {:span 2})\n(draw-box 0 {:span 2})",
+	},
+	DiagramType{
+		Name:             "c4plantuml",
+		Aliases:          []string{"c4"},
+		OutputFormats:    plantumlFormats,
+		FileExtensions:   []string{".c4puml", ".c4", ".c4plantuml"},
+		Options:          plantumlOptions,
+		DocumentationURL: "https://github.com/plantuml-stdlib/C4-PlantUML",
+		Example:          "@startuml\n!include C4_Context.puml\nPerson(user, \"User\")\nSystem(kroki, \"Kroki\")\nRel(user, kroki, \"Renders diagrams with\")\n@enduml",
+	},
+	DiagramType{
+		Name:             "d2",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".d2"},
+		Options:          d2Options,
+		DocumentationURL: "https://d2lang.com/",
+		Example:          "client -> kroki: render",
+	},
+	DiagramType{
+		Name:             "dbml",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".dbml"},
+		DocumentationURL: "https://dbml.dbdiagram.io/docs/",
+		Example:          "Table users {\n  id integer [primary key]\n  name varchar\n}",
+	},
+	DiagramType{
+		Name:             "ditaa",
+		OutputFormats:    []OutputFormat{PNG, SVG},
+		FileExtensions:   []string{".ditaa"},
+		Options:          ditaaOptions,
+		DocumentationURL: "https://ditaa.sourceforge.net/",
+		Example:          "+--------+   +-------+\n| Client |-->| Kroki |\n+--------+   +-------+",
+	},
+	DiagramType{
+		Name:             "erd",
+		OutputFormats:    []OutputFormat{PNG, SVG, JPEG, PDF},
+		FileExtensions:   []string{".erd", ".er"},
+		DocumentationURL: "https://github.com/BurntSushi/erd",
+		Example:          "[Person]\n*name\nheight\n\n[Location]\n*id\ncity\n\nPerson *--1 Location",
+	},
+	DiagramType{
+		Name:             "excalidraw",
+		Companion:        true,
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".excalidraw"},
+		DocumentationURL: "https://excalidraw.com/",
+		Example:          `{"type": "excalidraw", "version": 2, "source": "https://excalidraw.com", "elements": [], "appState": {"viewBackgroundColor": "#ffffff"}}`,
+	},
+	DiagramType{
+		Name:             "graphviz",
+		Aliases:          []string{"dot"},
+		OutputFormats:    []OutputFormat{PNG, SVG, JPEG, PDF},
+		FileExtensions:   []string{".dot", ".gv", ".graphviz"},
+		Options:          graphvizOptions,
+		DocumentationURL: "https://graphviz.org/doc/info/lang.html",
+		Example:          "digraph G {\n  client -> kroki;\n}",
+	},
+	DiagramType{
+		Name:             "mermaid",
+		Companion:        true,
+		OutputFormats:    []OutputFormat{PNG, SVG},
+		FileExtensions:   []string{".mermaid", ".mmd"},
+		Options:          mermaidOptions,
+		DocumentationURL: "https://mermaid.js.org/intro/",
+		Example:          "graph TD\n  Client --> Kroki",
+	},
+	DiagramType{
+		Name:             "nomnoml",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".nomnoml"},
+		DocumentationURL: "https://nomnoml.com/",
+		Example:          "[Client] -> [Kroki]",
+	},
+	DiagramType{
+		Name:             "nwdiag",
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".nwdiag"},
+		Options:          blockdiagOptions,
+		DocumentationURL: "http://blockdiag.com/en/nwdiag/",
+		Example:          "nwdiag {\n  network dmz {\n    web01;\n    web02;\n  }\n}",
+	},
+	DiagramType{
+		Name:             "packetdiag",
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".packetdiag"},
+		Options:          blockdiagOptions,
+		DocumentationURL: "http://blockdiag.com/en/nwdiag/packetdiag-examples.html",
+		Example:          "packetdiag {\n  colwidth = 32;\n  0-15: Source Port;\n  16-31: Destination Port;\n}",
+	},
+	DiagramType{
+		Name:             "pikchr",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".pikchr"},
+		DocumentationURL: "https://pikchr.org/home/doc/trunk/doc/userman.md",
+		Example:          "box \"Client\"\narrow\nbox \"Kroki\"",
+	},
+	DiagramType{
+		Name:             "plantuml",
+		OutputFormats:    plantumlFormats,
+		FileExtensions:   []string{".puml", ".plantuml", ".pu", ".iuml"},
+		Options:          plantumlOptions,
+		DocumentationURL: "https://plantuml.com/",
+		Example:          "@startuml\nClient -> Kroki: render\n@enduml",
+	},
+	DiagramType{
+		Name:             "rackdiag",
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".rackdiag"},
+		Options:          blockdiagOptions,
+		DocumentationURL: "http://blockdiag.com/en/nwdiag/rackdiag-examples.html",
+		Example:          "rackdiag {\n  16U;\n  1: UPS [2U];\n  3: Web Server;\n}",
+	},
+	DiagramType{
+		Name:             "seqdiag",
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".seqdiag"},
+		Options:          blockdiagOptions,
+		DocumentationURL: "http://blockdiag.com/en/seqdiag/",
+		Example:          "seqdiag {\n  client -> kroki [label = \"render\"];\n}",
+	},
+	DiagramType{
+		Name:             "structurizr",
+		OutputFormats:    plantumlFormats,
+		FileExtensions:   []string{".structurizr", ".dsl"},
+		Options:          structurizrOptions,
+		DocumentationURL: "https://docs.structurizr.com/dsl",
+		Example:          "workspace {\n  model {\n    user = person \"User\"\n    kroki = softwareSystem \"Kroki\"\n    user -> kroki \"Renders diagrams with\"\n  }\n  views {\n    systemContext kroki {\n      include *\n      autolayout lr\n    }\n  }\n}",
+	},
+	DiagramType{
+		Name:             "svgbob",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".svgbob", ".bob"},
+		Options:          svgbobOptions,
+		DocumentationURL: "https://github.com/ivanceras/svgbob",
+		Example:          ".--------.     .-------.\n| Client |---->| Kroki |\n'--------'     '-------'",
+	},
+	DiagramType{
+		Name:             "umlet",
+		OutputFormats:    []OutputFormat{PNG, SVG, JPEG},
+		FileExtensions:   []string{".umlet", ".uxf"},
+		DocumentationURL: "https://www.umlet.com/",
+		Example:          "<diagram program=\"umlet\" version=\"14.3.0\"><zoom_level>10</zoom_level><element><id>UMLClass</id><coordinates><x>10</x><y>10</y><w>100</w><h>30</h></coordinates><panel_attributes>Kroki</panel_attributes><additional_attributes></additional_attributes></element></diagram>",
+	},
+	DiagramType{
+		Name:             "vega",
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".vega", ".vg"},
+		DocumentationURL: "https://vega.github.io/vega/docs/",
+		Example:          `{"$schema": "https://vega.github.io/schema/vega/v5.json", "width": 100, "height": 100, "marks": [{"type": "rect", "encode": {"enter": {"x": {"value": 10}, "y": {"value": 10}, "width": {"value": 80}, "height": {"value": 80}, "fill": {"value": "steelblue"}}}}]}`,
+	},
+	DiagramType{
+		Name:             "vegalite",
+		Aliases:          []string{"vega-lite"},
+		OutputFormats:    rasterVectorPDF,
+		FileExtensions:   []string{".vegalite", ".vl"},
+		DocumentationURL: "https://vega.github.io/vega-lite/docs/",
+		Example:          `{"$schema": "https://vega.github.io/schema/vega-lite/v5.json", "data": {"values": [{"a": "A", "b": 28}, {"a": "B", "b": 55}]}, "mark": "bar", "encoding": {"x": {"field": "a", "type": "nominal"}, "y": {"field": "b", "type": "quantitative"}}}`,
+	},
+	DiagramType{
+		Name:             "wavedrom",
+		OutputFormats:    svgOnly,
+		FileExtensions:   []string{".wavedrom"},
+		DocumentationURL: "https://wavedrom.com/tutorial.html",
+		Example:          "{ signal: [\n  { name: \"clk\", wave: \"p....\" },\n  { name: \"data\", wave: \"x.34.x\", data: [\"A\", \"B\"] }\n]}",
+	},
+)
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagramRegistry_Lookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantType string
+	}{
+		{name: "plantuml", wantType: "plantuml"},
+		{name: "Mermaid", wantType: "mermaid"},
+		{name: "dot", wantType: "graphviz"},
+		{name: "vega-lite", wantType: "vegalite"},
+		{name: "visio"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		diagram, ok := Diagrams.Lookup(tt.name)
+		if ok != (tt.wantType != "") || diagram.Name != tt.wantType {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", tt.name, diagram.Name, ok, tt.wantType)
+		}
+	}
+}
+
+func TestDiagramRegistry_CheckFormat(t *testing.T) {
+	tests := []struct {
+		diagramType string
+		format      OutputFormat
+		wantErr     string
+	}{
+		{diagramType: "ditaa", format: PNG},
+		{diagramType: "dot", format: PDF},
+		{diagramType: "plantuml", format: TXT},
+		{diagramType: "c4", format: TEXT},
+		{diagramType: "structurizr", format: TEXT},
+		{diagramType: "svgbob", format: TEXT, wantErr: "diagram type svgbob cannot be rendered as text"},
+		{diagramType: "mermaid", format: TEXT, wantErr: "text output is available for: c4plantuml, plantuml, structurizr"},
+		{diagramType: "ditaa", format: PDF, wantErr: "diagram type ditaa cannot be rendered as pdf; it supports: png, svg"},
+		{diagramType: "wavedrom", format: PNG, wantErr: "cannot be rendered as png"},
+		{diagramType: "visio", format: SVG, wantErr: `unknown diagram type "visio"`},
+	}
+	for _, tt := range tests {
+		err := Diagrams.CheckFormat(tt.diagramType, tt.format)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckFormat(%s, %s): unexpected error: %v", tt.diagramType, tt.format, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("CheckFormat(%s, %s) = %v, want it to contain %q", tt.diagramType, tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+// Every type must render to SVG, which the inline, rasterizing and
+// validating tools rely on, and carry complete metadata.
+func TestDiagrams_Complete(t *testing.T) {
+	extensions := map[string]string{}
+	for _, diagram := range Diagrams.Types() {
+		if !diagram.SupportsFormat(SVG) {
+			t.Errorf("%s: does not support svg", diagram.Name)
+		}
+		if diagram.DocumentationURL == "" || diagram.Example == "" || len(diagram.FileExtensions) == 0 {
+			t.Errorf("%s: incomplete metadata %+v", diagram.Name, diagram)
+		}
+		for _, ext := range diagram.FileExtensions {
+			if !strings.HasPrefix(ext, ".") {
+				t.Errorf("%s: extension %q lacks the leading dot", diagram.Name, ext)
+			}
+			if other, dup := extensions[ext]; dup {
+				t.Errorf("extension %s is claimed by %s and %s", ext, other, diagram.Name)
+			}
+			extensions[ext] = diagram.Name
+		}
+	}
+}
+
+func TestNewDiagramRegistry_DuplicateNamePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an alias that is another type's name did not panic")
+		}
+	}()
+	NewDiagramRegistry(DiagramType{Name: "graphviz"}, DiagramType{Name: "dotty", Aliases: []string{"graphviz"}})
+}
@@ -0,0 +1,164 @@
+package svgconv
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/colornames"
+)
+
+// rebeccaPurple is the one CSS named color missing from the SVG 1.1 names
+// in colornames.
+var rebeccaPurple = color.NRGBA{R: 102, G: 51, B: 153, A: 255}
+
+// ParseColor parses a CSS color: a named color, transparent, #rgb, #rgba,
+// #rrggbb, #rrggbbaa, or an rgb(), rgba(), hsl() or hsla() function in the
+// comma or space separated syntax.
+func ParseColor(s string) (color.NRGBA, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	switch v {
+	case "transparent":
+		return color.NRGBA{}, nil
+	case "rebeccapurple":
+		return rebeccaPurple, nil
+	}
+	if c, ok := colornames.Map[v]; ok {
+		return color.NRGBA{R: c.R, G: c.G, B: c.B, A: c.A}, nil
+	}
+	if hex, ok := strings.CutPrefix(v, "#"); ok {
+		return parseHexColor(hex, s)
+	}
+	name, args, ok := strings.Cut(v, "(")
+	if !ok || !strings.HasSuffix(args, ")") {
+		return color.NRGBA{}, fmt.Errorf("unknown color %q", s)
+	}
+	components, alpha, err := colorArgs(strings.TrimSuffix(args, ")"))
+	if err != nil || len(components) != 3 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	var r, g, b float64
+	switch name {
+	case "rgb", "rgba":
+		values := make([]float64, 3)
+		for i, c := range components {
+			if values[i], err = colorComponent(c, 255); err != nil {
+				return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+			}
+		}
+		r, g, b = values[0]/255, values[1]/255, values[2]/255
+	case "hsl", "hsla":
+		h, err := strconv.ParseFloat(strings.TrimSuffix(components[0], "deg"), 64)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+		}
+		sat, err1 := colorComponent(components[1], 1)
+		light, err2 := colorComponent(components[2], 1)
+		if err1 != nil || err2 != nil || !strings.HasSuffix(components[1], "%") || !strings.HasSuffix(components[2], "%") {
+			return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+		}
+		r, g, b = hslToRGB(h, sat, light)
+	default:
+		return color.NRGBA{}, fmt.Errorf("unknown color function %q", name)
+	}
+	a := 1.0
+	if alpha != "" {
+		if a, err = colorComponent(alpha, 1); err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+		}
+	}
+	return color.NRGBA{R: unit8(r), G: unit8(g), B: unit8(b), A: unit8(a)}, nil
+}
+
+// parseHexColor parses the digits of a #rgb, #rgba, #rrggbb or #rrggbbaa
+// color.
+func parseHexColor(hex, s string) (color.NRGBA, error) {
+	if len(hex) == 3 || len(hex) == 4 {
+		var long strings.Builder
+		for _, d := range hex {
+			long.WriteRune(d)
+			long.WriteRune(d)
+		}
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
+// colorArgs splits the arguments of a color function into its three
+// components and the optional alpha, given either as a fourth comma
+// separated value or after a slash.
+func colorArgs(args string) (components []string, alpha string, err error) {
+	if before, after, ok := strings.Cut(args, "/"); ok {
+		args, alpha = before, strings.TrimSpace(after)
+	}
+	if strings.Contains(args, ",") {
+		components = strings.Split(args, ",")
+		for i := range components {
+			components[i] = strings.TrimSpace(components[i])
+		}
+	} else {
+		components = strings.Fields(args)
+	}
+	if len(components) == 4 && alpha == "" {
+		components, alpha = components[:3], components[3]
+	}
+	if len(components) != 3 {
+		return nil, "", fmt.Errorf("expected 3 components, got %d", len(components))
+	}
+	return components, alpha, nil
+}
+
+// colorComponent parses a number, or a percentage of limit, clamped to
+// [0, limit].
+func colorComponent(v string, limit float64) (float64, error) {
+	scale := 1.0
+	if p, ok := strings.CutSuffix(v, "%"); ok {
+		v, scale = p, limit/100
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	return math.Min(math.Max(f*scale, 0), limit), nil
+}
+
+// hslToRGB converts a hue in degrees and saturation and lightness in [0, 1]
+// to red, green and blue in [0, 1].
+func hslToRGB(h, s, l float64) (r, g, b float64) {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 360
+	if s == 0 {
+		return l, l, l
+	}
+	q := l + s - l*s
+	if l < 0.5 {
+		q = l * (1 + s)
+	}
+	p := 2*l - q
+	hue := func(t float64) float64 {
+		t = math.Mod(t+1, 1)
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 1.0/2:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+	return hue(h + 1.0/3), hue(h), hue(h - 1.0/3)
+}
+
+// unit8 scales a value in [0, 1] to a byte.
+func unit8(v float64) uint8 {
+	return uint8(math.Round(v * 255))
+}
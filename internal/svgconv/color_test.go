@@ -0,0 +1,46 @@
+package svgconv
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{in: "white", want: color.NRGBA{255, 255, 255, 255}},
+		{in: " RebeccaPurple ", want: color.NRGBA{102, 51, 153, 255}},
+		{in: "transparent", want: color.NRGBA{}},
+		{in: "#1e1e1e", want: color.NRGBA{30, 30, 30, 255}},
+		{in: "#f0a", want: color.NRGBA{255, 0, 170, 255}},
+		{in: "#ff000080", want: color.NRGBA{255, 0, 0, 128}},
+		{in: "rgb(255, 128, 0)", want: color.NRGBA{255, 128, 0, 255}},
+		{in: "rgba(0, 0, 255, 0.5)", want: color.NRGBA{0, 0, 255, 128}},
+		{in: "rgb(100% 0% 0% / 25%)", want: color.NRGBA{255, 0, 0, 64}},
+		{in: "hsl(120, 100%, 50%)", want: color.NRGBA{0, 255, 0, 255}},
+		{in: "hsla(240deg 100% 25% / 1)", want: color.NRGBA{0, 0, 128, 255}},
+		{in: "", wantErr: true},
+		{in: "pinkish", wantErr: true},
+		{in: "#12345", wantErr: true},
+		{in: "rgb(1, 2)", wantErr: true},
+		{in: "hsl(120, 1, 0.5)", wantErr: true},
+		{in: "cmyk(0, 0, 0, 0)", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseColor(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseColor(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseColor(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package svgconv
 
 import (
 	"fmt"
+	"image/color"
 	"image/jpeg"
 	"io"
 	"strings"
@@ -15,39 +16,102 @@ type OutputFormat string
 const (
 	PNG  OutputFormat = "png"
 	JPEG OutputFormat = "jpeg"
+	PDF  OutputFormat = "pdf"
+	// WebP and AVIF are encoded with libwebp and libaom, which the canvas
+	// library links only in builds with CGO and the "formats" build tag;
+	// other builds return an error for them.
+	WebP OutputFormat = "webp"
+	AVIF OutputFormat = "avif"
 )
 
+// DefaultBackground fills formats without an alpha channel when
+// Options.Background is empty.
+const DefaultBackground = "white"
+
+// DefaultQuality is the JPEG quality when Options.Quality is zero.
+const DefaultQuality = 90
+
 type Options struct {
 	Format OutputFormat
 	DPI    float64
+	// Background is a CSS color painted behind the diagram. Formats without
+	// an alpha channel (JPEG) default to DefaultBackground, or the dark
+	// surface with ThemeDark; the others stay transparent unless it is set,
+	// which flattens them onto it.
+	Background string
+	// Quality is the JPEG quality from 1 to 100; zero means DefaultQuality.
+	Quality int
+	// Theme, when set, applies ApplyTheme to the SVG first. ThemeAuto needs
+	// a browser to pick the scheme and is rejected.
+	Theme Theme
 }
 
 func Convert(out io.Writer, svg string, opt Options) error {
+	switch opt.Theme {
+	case "":
+	case ThemeAuto:
+		return fmt.Errorf("theme %s needs a browser showing the SVG; use %s or %s", ThemeAuto, ThemeLight, ThemeDark)
+	default:
+		svg = ApplyTheme(svg, opt.Theme)
+	}
 	c, err := canvas.ParseSVG(strings.NewReader(svg))
 	if err != nil {
 		return err
 	}
 
+	background := opt.Background
+	if background == "" && opt.Format == JPEG {
+		background = DefaultBackground
+		if opt.Theme == ThemeDark {
+			background = darkSurface
+		}
+	}
+	if background != "" {
+		bg, err := ParseColor(background)
+		if err != nil {
+			return fmt.Errorf("invalid background: %w", err)
+		}
+		paintBackground(c, bg)
+	}
+
 	opts := []any{canvas.DPI(opt.DPI)}
 	switch opt.Format {
 	case PNG:
 		writer := renderers.PNG(opts...)
 		return writer(out, c)
 	case JPEG:
-		ctx := canvas.NewContext(c)
-		// Set the background color to white
-		ctx.SetZIndex(-100)
-		rect := canvas.RectFromSize(0, 0, c.W, c.H).ToPath()
-		ctx.SetFillColor(canvas.Pink)
-		ctx.DrawPath(0, 0, rect)
-		ctx.Fill()
-		ctx.FillStroke()
-		ctx.Close()
-
-		opts = append(opts, &jpeg.Options{Quality: 90})
+		quality := opt.Quality
+		if quality == 0 {
+			quality = DefaultQuality
+		}
+		if quality < 1 || quality > 100 {
+			return fmt.Errorf("invalid quality %d: must be between 1 and 100", quality)
+		}
+		opts = append(opts, &jpeg.Options{Quality: quality})
 		writer := renderers.JPEG(opts...)
 		return writer(out, c)
+	case PDF:
+		// PDF keeps the vector paths, so the DPI does not apply.
+		writer := renderers.PDF()
+		return writer(out, c)
+	case WebP:
+		writer := renderers.WebP(opts...)
+		return writer(out, c)
+	case AVIF:
+		writer := renderers.AVIF(opts...)
+		return writer(out, c)
 	default:
 		return fmt.Errorf("unsupported format: %s", opt.Format)
 	}
 }
+
+// paintBackground fills the whole canvas with bg beneath the diagram's own
+// layers.
+func paintBackground(c *canvas.Canvas, bg color.Color) {
+	ctx := canvas.NewContext(c)
+	ctx.SetZIndex(-1)
+	ctx.SetFillColor(bg)
+	ctx.SetStrokeColor(canvas.Transparent)
+	ctx.DrawPath(0, 0, canvas.Rectangle(c.W, c.H))
+	ctx.SetZIndex(0)
+}
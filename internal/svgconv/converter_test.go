@@ -0,0 +1,92 @@
+package svgconv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" width="40" height="20"><rect width="40" height="20" fill="blue"/></svg>`
+	tests := []struct {
+		format OutputFormat
+		magic  []byte
+	}{
+		{format: PNG, magic: []byte("\x89PNG")},
+		{format: JPEG, magic: []byte{0xff, 0xd8}},
+		{format: PDF, magic: []byte("%PDF-")},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Convert(&buf, svg, Options{Format: tt.format, DPI: 96}); err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if !bytes.HasPrefix(buf.Bytes(), tt.magic) {
+				t.Errorf("output starts with %q, want %q", buf.Bytes()[:min(buf.Len(), 8)], tt.magic)
+			}
+		})
+	}
+	if err := Convert(&bytes.Buffer{}, svg, Options{Format: "bmp", DPI: 96}); err == nil {
+		t.Error("Convert to an unsupported format succeeded")
+	}
+}
+
+// cornerSVG leaves its top-left corner transparent.
+const cornerSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="40" height="40"><rect x="20" y="20" width="20" height="20" fill="blue"/></svg>`
+
+func convertCorner(t *testing.T, opt Options, decode func(r *bytes.Reader) (image.Image, error)) color.NRGBA {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Convert(&buf, cornerSVG, opt); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	img, err := decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA)
+}
+
+func TestConvert_Background(t *testing.T) {
+	decodeJPEG := func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }
+	decodePNG := func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }
+	near := func(got, want color.NRGBA) bool {
+		d := func(a, b uint8) int { return max(int(a)-int(b), int(b)-int(a)) }
+		return d(got.R, want.R) <= 4 && d(got.G, want.G) <= 4 && d(got.B, want.B) <= 4 && got.A == want.A
+	}
+
+	if got := convertCorner(t, Options{Format: JPEG, DPI: 96}, decodeJPEG); !near(got, color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("JPEG default background = %v, want white", got)
+	}
+	if got := convertCorner(t, Options{Format: JPEG, DPI: 96, Background: "#1e1e1e", Quality: 100}, decodeJPEG); !near(got, color.NRGBA{30, 30, 30, 255}) {
+		t.Errorf("JPEG background = %v, want #1e1e1e", got)
+	}
+	whiteCanvas := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 40 40"><rect x="0" y="0" width="40" height="40" fill="white"/></svg>`
+	var buf bytes.Buffer
+	if err := Convert(&buf, whiteCanvas, Options{Format: PNG, DPI: 96, Theme: ThemeDark}); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if img, err := png.Decode(&buf); err != nil || color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA).A != 0 {
+		t.Errorf("dark theme kept the white canvas (decode error %v)", err)
+	}
+	if got := convertCorner(t, Options{Format: PNG, DPI: 96}, decodePNG); got.A != 0 {
+		t.Errorf("PNG corner = %v, want transparent", got)
+	}
+	if got := convertCorner(t, Options{Format: PNG, DPI: 96, Background: "rgb(255, 255, 0)"}, decodePNG); !near(got, color.NRGBA{255, 255, 0, 255}) {
+		t.Errorf("flattened PNG corner = %v, want yellow", got)
+	}
+
+	if err := Convert(&bytes.Buffer{}, cornerSVG, Options{Format: PNG, DPI: 96, Background: "pinkish"}); err == nil {
+		t.Error("Convert with an invalid background succeeded")
+	}
+	if err := Convert(&bytes.Buffer{}, cornerSVG, Options{Format: JPEG, DPI: 96, Quality: 101}); err == nil {
+		t.Error("Convert with quality 101 succeeded")
+	}
+	if err := Convert(&bytes.Buffer{}, cornerSVG, Options{Format: PNG, DPI: 96, Theme: ThemeAuto}); err == nil {
+		t.Error("Convert with theme auto succeeded")
+	}
+}
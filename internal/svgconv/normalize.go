@@ -25,12 +25,12 @@ import (
 //
 // Only the root tag is rewritten. That removes the background PlantUML-style
 // output carries on the root element; backgrounds painted inside the body
-// (Graphviz's canvas polygon, Mermaid's embedded <style> rules) are out of
-// scope, as is re-theming shape-level fills and strokes — those are lossy
-// transforms, while a proportionally scaled diagram is legible on both themes
-// as-is. The rewrite is best-effort: input without a well-formed root <svg>
-// tag is returned unchanged, and input without a valid viewBox or positive
-// pixel dimensions to derive one from keeps its original sizing.
+// (Graphviz's canvas polygon, Mermaid's embedded <style> rules) and
+// shape-level fills and strokes are left to the opt-in ApplyTheme, as those
+// are lossy transforms, while a proportionally scaled diagram is legible on
+// both themes as-is. The rewrite is best-effort: input without a well-formed
+// root <svg> tag is returned unchanged, and input without a valid viewBox or
+// positive pixel dimensions to derive one from keeps its original sizing.
 func NormalizeForInline(in string) string {
 	start, end, name, rawAttrs, ok := locateRootSVGTag(in)
 	if !ok {
@@ -0,0 +1,512 @@
+package svgconv
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizePolicy configures what Sanitize keeps beyond its allowlist of
+// static SVG.
+type SanitizePolicy struct {
+	// ForeignObject keeps <foreignObject> elements, in which Mermaid draws
+	// its labels, with their HTML reduced to text formatting elements.
+	ForeignObject bool
+	// ExternalReferences keeps http and https URLs in links, images and
+	// url() references, which make the viewer contact other hosts.
+	ExternalReferences bool
+}
+
+// The named sanitize policies. Standard keeps Mermaid's HTML labels; strict
+// drops them; relaxed also keeps external links and images.
+var (
+	StrictPolicy   = SanitizePolicy{}
+	StandardPolicy = SanitizePolicy{ForeignObject: true}
+	RelaxedPolicy  = SanitizePolicy{ForeignObject: true, ExternalReferences: true}
+)
+
+// SanitizeOff names the absence of sanitization where a policy name is
+// configured.
+const SanitizeOff = "off"
+
+// SanitizePolicies lists the named policies.
+var SanitizePolicies = map[string]SanitizePolicy{
+	"strict":   StrictPolicy,
+	"standard": StandardPolicy,
+	"relaxed":  RelaxedPolicy,
+}
+
+// svgElements are the SVG elements Sanitize keeps: shapes, text, structure,
+// paint servers and filters. Scripts, animations (which can set attributes
+// such as href) and embedding elements are left out.
+var svgElements = setOf(
+	"svg", "g", "defs", "symbol", "use", "switch", "title", "desc", "metadata", "style",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+	"text", "tspan", "textPath", "a", "image", "marker", "clipPath", "mask", "pattern",
+	"linearGradient", "radialGradient", "stop", "filter",
+	"feBlend", "feColorMatrix", "feComponentTransfer", "feComposite", "feConvolveMatrix",
+	"feDiffuseLighting", "feDisplacementMap", "feDistantLight", "feDropShadow", "feFlood",
+	"feFuncA", "feFuncB", "feFuncG", "feFuncR", "feGaussianBlur", "feImage", "feMerge",
+	"feMergeNode", "feMorphology", "feOffset", "fePointLight", "feSpecularLighting",
+	"feSpotLight", "feTile", "feTurbulence",
+)
+
+// htmlElements are the HTML elements Sanitize keeps inside a kept
+// foreignObject.
+var htmlElements = setOf(
+	"div", "span", "p", "br", "b", "i", "u", "s", "em", "strong", "small", "sub", "sup",
+	"code", "pre", "kbd", "ul", "ol", "li", "dl", "dt", "dd", "table", "thead", "tbody",
+	"tfoot", "tr", "th", "td", "caption", "h1", "h2", "h3", "h4", "h5", "h6", "hr",
+	"label", "font", "center", "blockquote", "a", "img",
+)
+
+// urlAttributes hold a URL the viewer follows or loads.
+var urlAttributes = setOf("href", "src", "action", "formaction", "poster", "background", "srcset")
+
+// imageElements load the URL of their href or src as an image.
+var imageElements = setOf("image", "feImage", "img")
+
+// urlKind is where a URL is used, which decides the data: URIs it may be.
+type urlKind int
+
+const (
+	linkURL  urlKind = iota // followed or embedded as a document
+	imageURL                // loaded as an image
+	styleURL                // referenced from CSS: images and fonts
+)
+
+func setOf(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// cssBlocked are the constructs, matched in lowercase CSS without
+// whitespace, that make a declaration or rule import or run something.
+var cssBlocked = []string{"@import", "expression(", "javascript:", "vbscript:", "behavior:", "-moz-binding"}
+
+var (
+	// cssLoader matches the CSS functions that load a URL: url() and src()
+	// take one, image(), image-set() and cross-fade() also take strings.
+	cssLoader = regexp.MustCompile(`(?i)\b(url|src|image|image-set|cross-fade)\(`)
+	// cssURLArg matches the argument of an unquoted url(); a quoted one is
+	// one of the strings cssCode returns.
+	cssURLArg = regexp.MustCompile(`(?i)\burl\(\s*([^)\s\x00]*)`)
+
+	dataImageURL = regexp.MustCompile(`^data:image/(png|jpeg|jpg|gif|webp);`)
+	dataFontURL  = regexp.MustCompile(`^data:(font/[\w.+-]+|application/(x-)?font-[\w.+-]+|application/vnd\.ms-fontobject)[;,]`)
+
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;")
+)
+
+// Sanitize strips active content and remote references from an SVG for
+// inline display, keeping only allowlisted elements. It removes scripts,
+// animations and other elements outside the allowlist with their content,
+// on* event handler attributes, the document type (which can declare
+// entities), and URLs other than same-document #fragments and, for images,
+// data:image URIs of raster formats; policy can keep foreignObject HTML and
+// http(s) URLs. Embedded stylesheets and style attributes lose @import
+// rules and the declarations and rules that run script or reference a
+// disallowed URL, data: fonts being allowed there (D2 embeds its fonts).
+//
+// Comments are dropped. It returns the sanitized SVG and a description of
+// each removal. Unlike the other rewrites in this package it fails closed:
+// input that does not parse as XML is an error rather than returned
+// unchanged.
+func Sanitize(in string, policy SanitizePolicy) (string, []string, error) {
+	d := xml.NewDecoder(strings.NewReader(in))
+	d.Entity = xml.HTMLEntity
+	s := &sanitizer{policy: policy}
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", s.removed, fmt.Errorf("parse SVG: %w", err)
+		}
+		if err := s.token(tok); err != nil {
+			return "", s.removed, err
+		}
+	}
+	if len(s.open) > 0 {
+		return "", s.removed, errors.New("parse SVG: unexpected end of document")
+	}
+	s.closePending(false)
+	return s.out.String(), s.removed, nil
+}
+
+// sanitizer carries the state of one Sanitize pass.
+type sanitizer struct {
+	policy  SanitizePolicy
+	out     strings.Builder
+	removed []string
+
+	open    []string           // the names of all open elements
+	stack   []sanitizedElement // the open kept elements
+	skip    int                // nesting depth inside a removed element
+	pending bool               // a start tag awaits its > or />
+}
+
+type sanitizedElement struct {
+	html  bool // foreignObject or HTML inside one
+	style bool
+}
+
+func (s *sanitizer) remove(format string, args ...any) {
+	s.removed = append(s.removed, fmt.Sprintf(format, args...))
+}
+
+func (s *sanitizer) token(tok xml.Token) error {
+	// RawToken leaves matching end tags to the caller.
+	switch t := tok.(type) {
+	case xml.StartElement:
+		s.open = append(s.open, qualifiedName(t.Name))
+	case xml.EndElement:
+		n := len(s.open)
+		if n == 0 || s.open[n-1] != qualifiedName(t.Name) {
+			return fmt.Errorf("parse SVG: unexpected end element </%s>", qualifiedName(t.Name))
+		}
+		s.open = s.open[:n-1]
+	}
+	if s.skip > 0 {
+		switch tok.(type) {
+		case xml.StartElement:
+			s.skip++
+		case xml.EndElement:
+			s.skip--
+		}
+		return nil
+	}
+	switch t := tok.(type) {
+	case xml.StartElement:
+		s.closePending(false)
+		s.start(t)
+	case xml.EndElement:
+		s.stack = s.stack[:len(s.stack)-1]
+		if s.pending {
+			s.closePending(true)
+			return nil
+		}
+		s.out.WriteString("</" + qualifiedName(t.Name) + ">")
+	case xml.CharData:
+		s.closePending(false)
+		text := string(t)
+		if n := len(s.stack); n > 0 && s.stack[n-1].style {
+			text = s.sanitizeCSS(text, "stylesheet")
+		}
+		// > stays as it is so that CSS child selectors remain readable.
+		s.out.WriteString(textEscaper.Replace(text))
+	case xml.ProcInst:
+		if t.Target == "xml" {
+			s.out.WriteString("<?xml " + string(t.Inst) + "?>")
+		} else {
+			s.remove("processing instruction %s", t.Target)
+		}
+	case xml.Directive:
+		s.remove("document type declaration")
+	case xml.Comment:
+		// Dropped silently: comments are inert but only add weight.
+	}
+	return nil
+}
+
+// closePending ends a start tag left open, as /> when the element turned out
+// empty.
+func (s *sanitizer) closePending(empty bool) {
+	if !s.pending {
+		return
+	}
+	s.pending = false
+	if empty {
+		s.out.WriteString("/>")
+	} else {
+		s.out.WriteString(">")
+	}
+}
+
+func (s *sanitizer) start(t xml.StartElement) {
+	name := t.Name.Local
+	inHTML := len(s.stack) > 0 && s.stack[len(s.stack)-1].html
+	var allowed bool
+	switch {
+	case inHTML:
+		allowed = htmlElements[strings.ToLower(name)]
+	case name == "foreignObject":
+		allowed = s.policy.ForeignObject
+	default:
+		allowed = svgElements[name]
+	}
+	if !allowed {
+		s.remove("element %s", qualifiedName(t.Name))
+		s.skip = 1
+		return
+	}
+	s.stack = append(s.stack, sanitizedElement{
+		html:  inHTML || name == "foreignObject",
+		style: name == "style",
+	})
+
+	s.out.WriteString("<" + qualifiedName(t.Name))
+	for _, a := range t.Attr {
+		value, ok := s.attribute(qualifiedName(t.Name), a)
+		if !ok {
+			continue
+		}
+		s.out.WriteString(" " + qualifiedName(a.Name) + `="` + escapeAttrValue(value) + `"`)
+	}
+	s.pending = true
+}
+
+// attribute returns the sanitized value of attribute a of element, or false
+// when the attribute is removed.
+func (s *sanitizer) attribute(element string, a xml.Attr) (string, bool) {
+	name := strings.ToLower(a.Name.Local)
+	if a.Name.Space == "xmlns" || (a.Name.Space == "" && name == "xmlns") {
+		return a.Value, true
+	}
+	if strings.HasPrefix(name, "on") {
+		s.remove("attribute %s of %s", qualifiedName(a.Name), element)
+		return "", false
+	}
+	if urlAttributes[name] {
+		local := element[strings.IndexByte(element, ':')+1:]
+		kind := linkURL
+		if imageElements[local] {
+			kind = imageURL
+		}
+		if !s.allowedURL(a.Value, kind) {
+			s.remove("attribute %s of %s (%s)", qualifiedName(a.Name), element, a.Value)
+			return "", false
+		}
+		return a.Value, true
+	}
+	if name == "style" {
+		return s.sanitizeCSS(a.Value, "style of "+element), true
+	}
+	// Presentation attributes such as fill take CSS values, url() included.
+	if !s.cssRefsAllowed(cssCode(a.Value)) {
+		s.remove("attribute %s of %s (%s)", qualifiedName(a.Name), element, a.Value)
+		return "", false
+	}
+	return a.Value, true
+}
+
+// allowedURL reports whether the policy allows a URL used as kind: a
+// same-document fragment, a raster data:image URI for an image or in CSS, a
+// data: font in CSS, or an http(s) URL when external references are
+// allowed.
+func (s *sanitizer) allowedURL(raw string, kind urlKind) bool {
+	u := strings.ToLower(strings.Map(func(r rune) rune {
+		// Browsers ignore whitespace and control characters in schemes,
+		// as in "java\tscript:".
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, raw))
+	switch {
+	case strings.HasPrefix(u, "#"):
+		return true
+	case dataImageURL.MatchString(u):
+		return kind == imageURL || kind == styleURL
+	case dataFontURL.MatchString(u):
+		return kind == styleURL
+	case strings.HasPrefix(u, "https://"), strings.HasPrefix(u, "http://"):
+		return s.policy.ExternalReferences
+	}
+	return false
+}
+
+// sanitizeCSS drops the declarations of css, found in where, that run
+// script or reference a disallowed URL, and the rules whose prelude does,
+// @import included. Each is matched after decoding CSS escapes and dropping
+// comments, so that u\72l( is caught like url(, and removed whole rather
+// than rewritten, which leaves the escapes elsewhere, as in selectors,
+// intact.
+func (s *sanitizer) sanitizeCSS(css, where string) string {
+	var out strings.Builder
+	start, parens, skip := 0, 0, 0 // skip is the depth inside a dropped rule
+	var quote byte
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(css[i:], "/*"):
+			if end := strings.Index(css[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(css)
+			}
+		case c == '(':
+			parens++
+		case c == ')' && parens > 0:
+			parens--
+		case parens > 0:
+		case skip > 0:
+			switch c {
+			case '{':
+				skip++
+			case '}':
+				if skip--; skip == 0 {
+					start = i + 1
+				}
+			}
+		case c == ';' || c == '{' || c == '}':
+			if chunk := css[start:i]; s.cssAllowed(chunk) {
+				out.WriteString(css[start : i+1])
+			} else {
+				s.remove("%s: %s", where, strings.TrimSpace(chunk))
+				switch c {
+				case '{':
+					skip = 1
+				case '}':
+					out.WriteByte('}')
+				}
+			}
+			if skip == 0 {
+				start = i + 1
+			}
+		}
+	}
+	if rest := css[min(start, len(css)):]; skip == 0 && rest != "" {
+		if s.cssAllowed(rest) {
+			out.WriteString(rest)
+		} else {
+			s.remove("%s: %s", where, strings.TrimSpace(rest))
+		}
+	}
+	return out.String()
+}
+
+// cssAllowed reports whether a CSS declaration or rule prelude neither runs
+// script nor references a disallowed URL.
+func (s *sanitizer) cssAllowed(css string) bool {
+	code, strs := cssCode(css)
+	compact := strings.ToLower(strings.Join(strings.Fields(code), ""))
+	for _, blocked := range cssBlocked {
+		if strings.Contains(compact, blocked) {
+			return false
+		}
+	}
+	return s.cssRefsAllowed(code, strs)
+}
+
+// cssRefsAllowed reports whether the URLs loaded by CSS, given as cssCode
+// returns it, are allowed. Where a loading function appears, every string
+// counts as a URL, as in image-set("a.png" 1x).
+func (s *sanitizer) cssRefsAllowed(code string, strs []string) bool {
+	if !cssLoader.MatchString(code) {
+		return true
+	}
+	for _, m := range cssURLArg.FindAllStringSubmatch(code, -1) {
+		if m[1] != "" && !s.allowedURL(m[1], styleURL) {
+			return false
+		}
+	}
+	for _, str := range strs {
+		if !s.allowedURL(str, styleURL) {
+			return false
+		}
+	}
+	return true
+}
+
+// cssCode decodes the escapes in css and drops its comments, returning the
+// text outside strings, with each string replaced by a NUL, and the decoded
+// strings.
+func cssCode(css string) (string, []string) {
+	var code, str strings.Builder
+	var strs []string
+	var quote byte
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '\\':
+			r, n := cssEscape(css[i+1:])
+			if quote != 0 {
+				str.WriteString(r)
+			} else {
+				code.WriteString(r)
+			}
+			i += n
+		case quote != 0 && c == quote:
+			strs = append(strs, str.String())
+			str.Reset()
+			quote = 0
+		case quote != 0:
+			str.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+			code.WriteByte(0)
+		case strings.HasPrefix(css[i:], "/*"):
+			if end := strings.Index(css[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(css)
+			}
+		default:
+			code.WriteByte(c)
+		}
+	}
+	if quote != 0 {
+		strs = append(strs, str.String())
+	}
+	return code.String(), strs
+}
+
+// cssEscape decodes the CSS escape that follows a backslash at the start of
+// s, returning the character and the number of bytes it took.
+func cssEscape(s string) (string, int) {
+	n := 0
+	for n < len(s) && n < 6 && isHexDigit(s[n]) {
+		n++
+	}
+	if n == 0 {
+		if s == "" || s[0] == '\n' {
+			// An escaped newline continues a string.
+			return "", min(len(s), 1)
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		return s[:size], size
+	}
+	v, _ := strconv.ParseUint(s[:n], 16, 32)
+	r := rune(v)
+	if r == 0 || !utf8.ValidRune(r) {
+		r = utf8.RuneError
+	}
+	if n < len(s) && strings.IndexByte(" \t\n\r\f", s[n]) >= 0 {
+		n++
+	}
+	return string(r), n
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// SanitizePolicyNames returns the names a policy can be configured with,
+// including SanitizeOff.
+func SanitizePolicyNames() []string {
+	names := []string{SanitizeOff}
+	for name := range SanitizePolicies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
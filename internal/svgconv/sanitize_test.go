@@ -0,0 +1,176 @@
+package svgconv
+
+import (
+	"strings"
+	"testing"
+)
+
+// hostileSVG carries the active content and remote references Sanitize
+// removes, next to static content it keeps.
+const hostileSVG = `<?xml version="1.0"?>
+<!DOCTYPE svg [<!ENTITY x "y">]>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10" onload="alert(1)">
+<script>alert(2)</script>
+<style>@import url(https://evil.example/a.css);
+.a{fill:url(#grad);background:url("https://evil.example/t.png")}
+.b>text{fill:red}</style>
+<defs><linearGradient id="grad"><stop offset="0" stop-color="red"/></linearGradient></defs>
+<a xlink:href="javascript:alert(3)"><rect class="a" width="5" height="5" onclick="alert(4)"/></a>
+<a href="https://example.com/docs"><text x="1" y="9" fill="url(https://evil.example/p)">doc &amp; link</text></a>
+<use href="#grad"/>
+<image href="data:image/png;base64,AAAA" width="1" height="1"/>
+<image href="data:image/svg+xml;base64,AAAA" width="1" height="1"/>
+<set attributeName="href" to="javascript:alert(5)"/>
+<rect width="1" height="1" style="fill:red;behavior:url(x.htc)"/>
+<foreignObject width="10" height="10"><div xmlns="http://www.w3.org/1999/xhtml"><span class="label">A<br/>B</span><iframe src="https://evil.example/"></iframe><img src="https://evil.example/i.png"/></div></foreignObject>
+</svg>`
+
+func TestSanitize_Standard(t *testing.T) {
+	got, removed, err := Sanitize(hostileSVG, StandardPolicy)
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	for _, bad := range []string{
+		"<!DOCTYPE", "onload", "<script", "alert", "@import", "evil.example",
+		"javascript:", "onclick", "svg+xml", "<set", "behavior", "<iframe", "<img src",
+		"https://example.com",
+	} {
+		if strings.Contains(got, bad) {
+			t.Errorf("sanitized SVG contains %q:\n%s", bad, got)
+		}
+	}
+	for _, want := range []string{
+		`<?xml version="1.0"?>`,
+		`xmlns:xlink="http://www.w3.org/1999/xlink"`,
+		`fill:url(#grad)`,
+		`.b>text{fill:red}`,
+		`<use href="#grad"/>`,
+		`<image href="data:image/png;base64,AAAA" width="1" height="1"/>`,
+		`<rect class="a" width="5" height="5"/>`,
+		`doc &amp; link`,
+		`style="fill:red;"`,
+		`<span class="label">A<br/>B</span>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sanitized SVG lacks %q:\n%s", want, got)
+		}
+	}
+
+	report := strings.Join(removed, "\n")
+	for _, want := range []string{
+		"document type declaration",
+		"attribute onload of svg",
+		"element script",
+		"element set",
+		"element iframe",
+		"attribute xlink:href of a (javascript:alert(3))",
+		"stylesheet: @import url(https://evil.example/a.css)",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestSanitize_Strict(t *testing.T) {
+	got, removed, err := Sanitize(hostileSVG, StrictPolicy)
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	if strings.Contains(got, "foreignObject") || strings.Contains(got, "label") {
+		t.Errorf("strict policy kept foreignObject:\n%s", got)
+	}
+	if !strings.Contains(strings.Join(removed, "\n"), "element foreignObject") {
+		t.Errorf("report lacks the foreignObject: %q", removed)
+	}
+}
+
+func TestSanitize_Relaxed(t *testing.T) {
+	got, _, err := Sanitize(hostileSVG, RelaxedPolicy)
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	for _, want := range []string{`<a href="https://example.com/docs">`, `<img src="https://evil.example/i.png"/>`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("relaxed policy dropped %q:\n%s", want, got)
+		}
+	}
+	for _, bad := range []string{"javascript:", "<script", "@import"} {
+		if strings.Contains(got, bad) {
+			t.Errorf("relaxed policy kept %q:\n%s", bad, got)
+		}
+	}
+}
+
+// d2FontSVG is trimmed D2 output: its fonts are embedded as data URIs in
+// @font-face rules inside a CDATA stylesheet.
+const d2FontSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 50"><style type="text/css"><![CDATA[
+.d2-1 .text{font-family:"d2-1-font-regular";}
+@font-face {
+	font-family: d2-1-font-regular;
+	src: url("data:application/font-woff;base64,d09GRgABAAAAAA==");
+}
+.d2-1 .fill-N1{fill:#0A0F25;}
+]]></style><text class="text fill-N1" x="10" y="20">a</text></svg>`
+
+func TestSanitize_KeepsStaticDiagrams(t *testing.T) {
+	for name, in := range map[string]string{"graphviz": graphvizSVG, "mermaid": mermaidSVG, "d2": d2SVG, "d2 font": d2FontSVG} {
+		got, removed, err := Sanitize(in, StandardPolicy)
+		if err != nil {
+			t.Fatalf("%s: Sanitize: %v", name, err)
+		}
+		if len(removed) != 0 {
+			t.Errorf("%s: removed %q", name, removed)
+		}
+		if _, _, err := Sanitize(got, StandardPolicy); err != nil {
+			t.Errorf("%s: output does not parse: %v", name, err)
+		}
+	}
+	got, _, _ := Sanitize(d2FontSVG, StandardPolicy)
+	if !strings.Contains(got, `src: url("data:application/font-woff;base64,d09GRgABAAAAAA==");`) {
+		t.Errorf("D2 font removed:\n%s", got)
+	}
+}
+
+func TestSanitize_ObfuscatedURLs(t *testing.T) {
+	for _, href := range []string{"java\tscript:alert(1)", " JavaScript:alert(1)", "vbscript:x", "data:text/html,<b>", "//evil.example/x", "x.png"} {
+		in := `<svg xmlns="http://www.w3.org/2000/svg"><a href="` + escapeAttrValue(href) + `"><rect/></a></svg>`
+		got, removed, err := Sanitize(in, RelaxedPolicy)
+		if err != nil {
+			t.Fatalf("%q: Sanitize: %v", href, err)
+		}
+		if strings.Contains(got, "href") || len(removed) != 1 {
+			t.Errorf("%q kept: %s (removed %q)", href, got, removed)
+		}
+	}
+
+	// CSS hides URLs behind escapes, comments and functions other than url().
+	for _, tt := range []struct{ stylesheet, style string }{
+		{stylesheet: `.a{background:u\72l(https://evil.example/x.png)}`},
+		{style: `background:u\72l(https://evil.example/x.png)`},
+		{stylesheet: `.a{background-image:image-set("https://evil.example/y.png" 1x)}`},
+		{style: `background-image:-webkit-image-set("https://evil.example/y.png" 1x)`},
+		{stylesheet: `@\69mport "https://evil.example/z.css";`},
+		{stylesheet: `@media screen{.a{background:url('https://evil.example/x.png')}}`},
+		{stylesheet: `.a{background:url(https:/* */\2f/evil.example/x.png)}`},
+		{style: `width:expr\65ssion(alert(1))`},
+		{style: `fill:red;background:url("https://evil.example/x.png`},
+	} {
+		in := `<svg xmlns="http://www.w3.org/2000/svg"><style>` + tt.stylesheet + `</style><rect style="` + escapeAttrValue(tt.style) + `"/></svg>`
+		got, removed, err := Sanitize(in, StandardPolicy)
+		if err != nil {
+			t.Fatalf("%+v: Sanitize: %v", tt, err)
+		}
+		if strings.Contains(got, "evil.example") || strings.Contains(got, "ssion") || len(removed) != 1 {
+			t.Errorf("%+v kept: %s (removed %q)", tt, got, removed)
+		}
+	}
+}
+
+func TestSanitize_RejectsMalformed(t *testing.T) {
+	for _, in := range []string{`<svg><g></svg>`, `<svg><g></rect></svg>`, `<svg><rect`, `<svg><script>`} {
+		if _, _, err := Sanitize(in, StandardPolicy); err == nil {
+			t.Errorf("Sanitize(%q) succeeded", in)
+		}
+	}
+}
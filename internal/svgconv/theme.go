@@ -0,0 +1,560 @@
+package svgconv
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Theme selects how ApplyTheme adapts a diagram to the page it is shown on.
+type Theme string
+
+const (
+	// ThemeLight only removes the diagram's own background.
+	ThemeLight Theme = "light"
+	// ThemeDark also turns near-black paint light and near-white paint
+	// dark.
+	ThemeDark Theme = "dark"
+	// ThemeAuto applies the dark remapping only when the viewer prefers a
+	// dark color scheme, through a prefers-color-scheme media query. It only
+	// works where the SVG is displayed by a browser.
+	ThemeAuto Theme = "auto"
+)
+
+// Themes lists the accepted Theme values.
+var Themes = []string{string(ThemeLight), string(ThemeDark), string(ThemeAuto)}
+
+// ParseTheme validates a theme name, ignoring case.
+func ParseTheme(s string) (Theme, error) {
+	t := Theme(strings.ToLower(strings.TrimSpace(s)))
+	switch t {
+	case ThemeLight, ThemeDark, ThemeAuto:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown theme %q (supported: %s)", s, strings.Join(Themes, ", "))
+}
+
+// The dark palette: near-black paint becomes the foreground, near-white
+// paint a dark surface.
+const (
+	darkForeground = "#e6e6e6"
+	darkSurface    = "#2b2b2b"
+)
+
+// The luminance bounds of near-black and near-white paint. Mermaid's #333
+// text is near-black; its #ECECFF node fill is near-white.
+const (
+	maxForegroundLuminance = 0.05
+	minSurfaceLuminance    = 0.8
+)
+
+// colorRole is the part a paint plays in the palette.
+type colorRole int
+
+const (
+	roleNone colorRole = iota
+	roleForeground
+	roleSurface
+)
+
+// roleOf classifies a paint value; none, url() references, currentColor and
+// transparent colors play no role.
+func roleOf(value string) colorRole {
+	c, err := ParseColor(value)
+	if err != nil || c.A == 0 {
+		return roleNone
+	}
+	l := relativeLuminance(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+	switch {
+	case l <= maxForegroundLuminance:
+		return roleForeground
+	case l >= minSurfaceLuminance:
+		return roleSurface
+	}
+	return roleNone
+}
+
+// relativeLuminance is the WCAG relative luminance of an sRGB color.
+func relativeLuminance(r, g, b float64) float64 {
+	linear := func(c float64) float64 {
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
+
+// darkColor returns the dark palette color for role.
+func darkColor(role colorRole) string {
+	if role == roleForeground {
+		return darkForeground
+	}
+	return darkSurface
+}
+
+// themeClass names the class ThemeAuto marks paint of role on property with.
+func themeClass(property string, role colorRole) string {
+	if role == roleForeground {
+		return "kroki-fg-" + property
+	}
+	return "kroki-bg-" + property
+}
+
+// autoThemeRules restyles the classes ThemeAuto adds when the viewer prefers
+// a dark color scheme. !important lets them win over inline style
+// attributes.
+var autoThemeRules = func() string {
+	var b strings.Builder
+	for _, property := range []string{"fill", "stroke"} {
+		for _, role := range []colorRole{roleForeground, roleSurface} {
+			fmt.Fprintf(&b, ".%s{%s:%s !important}", themeClass(property, role), property, darkColor(role))
+		}
+	}
+	return b.String()
+}()
+
+var (
+	tagAttr     = regexp.MustCompile(`([^\s=/>]+)\s*=\s*("[^"]*"|'[^']*')`)
+	cssRule     = regexp.MustCompile(`([^{}]+)\{([^{}]*)\}`)
+	cssColorDec = regexp.MustCompile(`(?i)(^|[;{\s])(fill|stroke|color|background-color|background|stop-color)(\s*:\s*)([^;}!]+)`)
+	cssBgDec    = regexp.MustCompile(`(?i)(^|;)\s*background(-color)?\s*:[^;}]*;?`)
+	styleElem   = regexp.MustCompile(`(?is)<style\b[^>]*>(.*?)</style`)
+	cssClass    = regexp.MustCompile(`\.(-?[_a-zA-Z][\w-]*)`)
+)
+
+// paintProperties are the presentation attributes and style properties
+// ApplyTheme remaps.
+var paintProperties = map[string]bool{"fill": true, "stroke": true}
+
+// shapeElements are the elements that paint; the first one in a document is
+// the only candidate for a background.
+var shapeElements = map[string]bool{
+	"rect": true, "polygon": true, "path": true, "circle": true, "ellipse": true,
+	"line": true, "polyline": true, "text": true, "image": true, "use": true,
+}
+
+// ApplyTheme adapts the body of a Kroki-rendered SVG to a page theme, going
+// further than NormalizeForInline:
+//
+//   - background shapes the engines paint inside the body are removed:
+//     Graphviz's canvas polygon, a first rect covering the whole canvas (D2,
+//     PlantUML) and background declarations on the root rule of an embedded
+//     stylesheet (Mermaid);
+//   - with ThemeDark, near-black fill and stroke paint (attributes, style
+//     attributes and embedded stylesheets) becomes light and near-white
+//     paint dark, and text without a fill of its own, black by default,
+//     gets the light foreground;
+//   - with ThemeAuto, the same paint is marked with classes that a
+//     prefers-color-scheme: dark media query restyles, leaving the light
+//     rendering as is.
+//
+// Other colors are kept. The rewrite works on the markup rather than a
+// parsed tree and is best-effort: what it does not recognize is copied
+// through unchanged.
+func ApplyTheme(in string, theme Theme) string {
+	t := &themer{theme: theme, viewBox: rootViewBox(in), fillClasses: stylesheetFillClasses(in)}
+	return t.apply(in)
+}
+
+// themer carries the state of one ApplyTheme pass.
+type themer struct {
+	theme   Theme
+	viewBox [4]float64 // min-x, min-y, width, height; zero when unknown
+	rootID  string
+	// fillClasses are the classes the document's stylesheets give a fill.
+	fillClasses map[string]bool
+
+	out       strings.Builder
+	styleAt   int // where the ThemeAuto stylesheet goes: after the root tag
+	autoCSS   strings.Builder
+	parents   []startTag
+	seenShape bool
+}
+
+// startTag is a parsed start tag.
+type startTag struct {
+	name  string
+	attrs []tagAttribute
+}
+
+type tagAttribute struct {
+	name, value string
+	quote       byte
+}
+
+func (a tagAttribute) String() string {
+	return fmt.Sprintf("%s=%c%s%c", a.name, a.quote, a.value, a.quote)
+}
+
+func (t *themer) apply(in string) string {
+	rest := in
+	for {
+		i := strings.IndexByte(rest, '<')
+		if i < 0 {
+			t.out.WriteString(rest)
+			break
+		}
+		t.out.WriteString(rest[:i])
+		rest = rest[i:]
+		var n int
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			n = tokenEnd(rest, "-->")
+			t.out.WriteString(rest[:n])
+		case strings.HasPrefix(rest, "<![CDATA["):
+			n = tokenEnd(rest, "]]>")
+			t.out.WriteString(rest[:n])
+		case strings.HasPrefix(rest, "<?"), strings.HasPrefix(rest, "<!"):
+			n = tokenEnd(rest, ">")
+			t.out.WriteString(rest[:n])
+		case strings.HasPrefix(rest, "</"):
+			n = tokenEnd(rest, ">")
+			t.endTag(rest[:n])
+		default:
+			n = tokenEnd(rest, ">")
+			rest = t.startTag(rest[:n], rest[n:])
+			continue
+		}
+		rest = rest[n:]
+	}
+
+	s := t.out.String()
+	if t.theme == ThemeAuto && t.styleAt > 0 {
+		css := "@media (prefers-color-scheme: dark){" + autoThemeRules + t.autoCSS.String() + "}"
+		s = s[:t.styleAt] + "<style>" + css + "</style>" + s[t.styleAt:]
+	}
+	return s
+}
+
+// tokenEnd returns the length of the markup token at the start of s ending
+// with terminator, or of s when it is unterminated.
+func tokenEnd(s, terminator string) int {
+	if i := strings.Index(s, terminator); i >= 0 {
+		return i + len(terminator)
+	}
+	return len(s)
+}
+
+func (t *themer) endTag(raw string) {
+	if len(t.parents) > 0 {
+		t.parents = t.parents[:len(t.parents)-1]
+	}
+	t.out.WriteString(raw)
+}
+
+// startTag handles the start tag raw, followed by rest, and returns what is
+// left to scan.
+func (t *themer) startTag(raw, rest string) string {
+	selfClosing := strings.HasSuffix(raw, "/>")
+	body := strings.TrimSuffix(strings.TrimSuffix(raw, ">"), "/")
+	body = strings.TrimPrefix(body, "<")
+	nameEnd := strings.IndexFunc(body, unicode.IsSpace)
+	if nameEnd < 0 {
+		nameEnd = len(body)
+	}
+	name, attrText := body[:nameEnd], body[nameEnd:]
+	tag := startTag{name: name}
+	for _, m := range tagAttr.FindAllStringSubmatch(attrText, -1) {
+		tag.attrs = append(tag.attrs, tagAttribute{name: m[1], value: m[2][1 : len(m[2])-1], quote: m[2][0]})
+	}
+	local := strings.ToLower(name[strings.IndexByte(name, ':')+1:])
+
+	if local == "svg" && len(t.parents) == 0 && t.styleAt == 0 {
+		t.rootID, _ = tag.get("id")
+		t.out.WriteString(raw)
+		t.styleAt = t.out.Len()
+		if !selfClosing {
+			t.parents = append(t.parents, tag)
+		}
+		return rest
+	}
+
+	if shapeElements[local] {
+		first := !t.seenShape
+		t.seenShape = true
+		if first && t.isBackground(local, tag) {
+			if selfClosing {
+				return rest
+			}
+			// Drop the element with its content, e.g. a <title>.
+			end := "</" + name + ">"
+			if i := strings.Index(rest, end); i >= 0 {
+				return rest[i+len(end):]
+			}
+			return rest
+		}
+	}
+
+	changed := t.restyle(local, &tag)
+	if changed {
+		t.out.WriteString(tag.String(selfClosing))
+	} else {
+		t.out.WriteString(raw)
+	}
+	if selfClosing {
+		return rest
+	}
+	t.parents = append(t.parents, tag)
+	if local == "style" {
+		end := strings.Index(rest, "</"+name)
+		if end < 0 {
+			end = len(rest)
+		}
+		t.out.WriteString(t.restyleCSS(rest[:end]))
+		return rest[end:]
+	}
+	return rest
+}
+
+func (tag startTag) get(name string) (string, bool) {
+	for _, a := range tag.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+func (tag *startTag) set(name, value string) {
+	for i, a := range tag.attrs {
+		if a.name == name {
+			tag.attrs[i].value = value
+			return
+		}
+	}
+	tag.attrs = append(tag.attrs, tagAttribute{name: name, value: value, quote: '"'})
+}
+
+func (tag startTag) String(selfClosing bool) string {
+	var b strings.Builder
+	b.WriteString("<" + tag.name)
+	for _, a := range tag.attrs {
+		b.WriteString(" " + a.String())
+	}
+	if selfClosing {
+		b.WriteString("/")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// isBackground reports whether the first shape of the document paints the
+// diagram's background: Graphviz's polygon opening the graph group, or a
+// near-white rect covering the canvas.
+func (t *themer) isBackground(local string, tag startTag) bool {
+	fill, ok := tag.get("fill")
+	if !ok {
+		fill = styleProperty(attrValue(tag, "style"), "fill")
+	}
+	if roleOf(fill) != roleSurface {
+		return false
+	}
+	switch local {
+	case "polygon":
+		if len(t.parents) == 0 {
+			return false
+		}
+		class, _ := t.parents[len(t.parents)-1].get("class")
+		return slices.Contains(strings.Fields(class), "graph")
+	case "rect":
+		width, height := attrValue(tag, "width"), attrValue(tag, "height")
+		if width == "100%" && height == "100%" {
+			return true
+		}
+		x, _ := strconv.ParseFloat(strings.TrimSuffix(attrValue(tag, "x"), "px"), 64)
+		y, _ := strconv.ParseFloat(strings.TrimSuffix(attrValue(tag, "y"), "px"), 64)
+		w, errW := strconv.ParseFloat(strings.TrimSuffix(width, "px"), 64)
+		h, errH := strconv.ParseFloat(strings.TrimSuffix(height, "px"), 64)
+		vb := t.viewBox
+		return errW == nil && errH == nil && vb[2] > 0 && vb[3] > 0 &&
+			x <= vb[0] && y <= vb[1] && x+w >= vb[0]+vb[2] && y+h >= vb[1]+vb[3]
+	}
+	return false
+}
+
+// restyle remaps the paint of tag for the theme and reports whether it
+// changed.
+func (t *themer) restyle(local string, tag *startTag) bool {
+	if t.theme != ThemeDark && t.theme != ThemeAuto {
+		return false
+	}
+	changed := false
+	var classes []string
+	paint := func(property, value string) (string, bool) {
+		role := roleOf(value)
+		if role == roleNone {
+			return value, false
+		}
+		if t.theme == ThemeAuto {
+			classes = append(classes, themeClass(property, role))
+			return value, false
+		}
+		return darkColor(role), true
+	}
+
+	for i, a := range tag.attrs {
+		switch {
+		case paintProperties[a.name]:
+			if v, ok := paint(a.name, a.value); ok {
+				tag.attrs[i].value, changed = v, true
+			}
+		case a.name == "style":
+			style := cssColorDec.ReplaceAllStringFunc(a.value, func(decl string) string {
+				m := cssColorDec.FindStringSubmatch(decl)
+				property := strings.ToLower(m[2])
+				if !paintProperties[property] {
+					return decl
+				}
+				v, ok := paint(property, strings.TrimSpace(m[4]))
+				if !ok {
+					return decl
+				}
+				return m[1] + m[2] + m[3] + v
+			})
+			if style != a.value {
+				tag.attrs[i].value, changed = style, true
+			}
+		}
+	}
+
+	// Text without a fill of its own is black unless an ancestor sets one.
+	if local == "text" && !t.inheritsFill() {
+		if !t.hasFill(*tag) {
+			if t.theme == ThemeAuto {
+				classes = append(classes, themeClass("fill", roleForeground))
+			} else {
+				tag.set("fill", darkForeground)
+				changed = true
+			}
+		}
+	}
+
+	if len(classes) > 0 {
+		class := strings.TrimSpace(attrValue(*tag, "class") + " " + strings.Join(classes, " "))
+		tag.set("class", class)
+		changed = true
+	}
+	return changed
+}
+
+// inheritsFill reports whether an enclosing element sets a fill.
+func (t *themer) inheritsFill() bool {
+	return slices.ContainsFunc(t.parents, t.hasFill)
+}
+
+// hasFill reports whether tag sets a fill: an attribute, a style attribute
+// or a class a stylesheet gives one, as D2 colors its text.
+func (t *themer) hasFill(tag startTag) bool {
+	if _, ok := tag.get("fill"); ok || styleProperty(attrValue(tag, "style"), "fill") != "" {
+		return true
+	}
+	return slices.ContainsFunc(strings.Fields(attrValue(tag, "class")), func(c string) bool { return t.fillClasses[c] })
+}
+
+// stylesheetFillClasses returns the classes the <style> elements of in give
+// a fill: those of the element a rule with a fill declaration selects, e.g.
+// fill-N1 for ".d2-1 .fill-N1".
+func stylesheetFillClasses(in string) map[string]bool {
+	classes := map[string]bool{}
+	for _, style := range styleElem.FindAllStringSubmatch(in, -1) {
+		for _, rule := range cssRule.FindAllStringSubmatch(style[1], -1) {
+			if styleProperty(rule[2], "fill") == "" {
+				continue
+			}
+			for _, selector := range strings.Split(rule[1], ",") {
+				compounds := strings.FieldsFunc(selector, func(r rune) bool {
+					return unicode.IsSpace(r) || strings.ContainsRune(">+~", r)
+				})
+				if len(compounds) == 0 {
+					continue
+				}
+				for _, m := range cssClass.FindAllStringSubmatch(compounds[len(compounds)-1], -1) {
+					classes[m[1]] = true
+				}
+			}
+		}
+	}
+	return classes
+}
+
+// restyleCSS themes the content of a <style> element: background
+// declarations on the root rule are dropped and, with ThemeDark, paint
+// colors remapped; with ThemeAuto the remapped declarations are collected
+// for the media query instead.
+func (t *themer) restyleCSS(css string) string {
+	return cssRule.ReplaceAllStringFunc(css, func(rule string) string {
+		m := cssRule.FindStringSubmatch(rule)
+		selector, decls := m[1], m[2]
+		if t.isRootSelector(selector) {
+			decls = strings.TrimPrefix(cssBgDec.ReplaceAllString(decls, "$1"), ";")
+		}
+		if t.theme != ThemeDark && t.theme != ThemeAuto {
+			return selector + "{" + decls + "}"
+		}
+		var dark []string
+		remapped := cssColorDec.ReplaceAllStringFunc(decls, func(decl string) string {
+			d := cssColorDec.FindStringSubmatch(decl)
+			role := roleOf(strings.TrimSpace(d[4]))
+			if role == roleNone {
+				return decl
+			}
+			dark = append(dark, d[2]+":"+darkColor(role)+" !important")
+			return d[1] + d[2] + d[3] + darkColor(role)
+		})
+		if t.theme == ThemeAuto {
+			if len(dark) > 0 {
+				t.autoCSS.WriteString(strings.TrimSpace(selector) + "{" + strings.Join(dark, ";") + "}")
+			}
+			return selector + "{" + decls + "}"
+		}
+		return selector + "{" + remapped + "}"
+	})
+}
+
+// isRootSelector reports whether a CSS selector targets the root element,
+// as Mermaid's #<id> rule does.
+func (t *themer) isRootSelector(selector string) bool {
+	selector = strings.TrimSpace(selector)
+	return selector == "svg" || selector == ":root" || (t.rootID != "" && selector == "#"+t.rootID)
+}
+
+// rootViewBox returns the viewBox of the root <svg> tag, or zeros.
+func rootViewBox(in string) [4]float64 {
+	var vb [4]float64
+	_, _, _, attrs, ok := locateRootSVGTag(in)
+	if !ok {
+		return vb
+	}
+	for _, a := range attrs {
+		if a.Name.Space == "" && strings.EqualFold(a.Name.Local, "viewBox") && validViewBox(a.Value) {
+			for i, f := range strings.FieldsFunc(a.Value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+				if i < 4 {
+					vb[i], _ = strconv.ParseFloat(f, 64)
+				}
+			}
+		}
+	}
+	return vb
+}
+
+// attrValue returns the value of the attribute name of tag, or "".
+func attrValue(tag startTag, name string) string {
+	v, _ := tag.get(name)
+	return v
+}
+
+// styleProperty returns the value of property in a style attribute, or "".
+func styleProperty(style, property string) string {
+	for _, decl := range splitStyleDeclarations(style) {
+		name, value, ok := strings.Cut(decl, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), property) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
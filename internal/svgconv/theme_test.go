@@ -0,0 +1,121 @@
+package svgconv
+
+import (
+	"strings"
+	"testing"
+)
+
+// graphvizSVG is trimmed Graphviz output: a white canvas polygon opens the
+// graph group, and text carries no fill.
+const graphvizSVG = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!-- Generated by graphviz -->
+<svg width="62pt" height="116pt" viewBox="0.00 0.00 62.00 116.00" xmlns="http://www.w3.org/2000/svg">
+<g id="graph0" class="graph" transform="scale(1 1) rotate(0) translate(4 112)">
+<polygon fill="white" stroke="none" points="-4,4 -4,-112 58,-112 58,4 -4,4"/>
+<g id="node1" class="node">
+<title>a</title>
+<ellipse fill="none" stroke="black" cx="27" cy="-90" rx="27" ry="18"/>
+<text text-anchor="middle" x="27" y="-86.3" font-family="Times,serif" font-size="14.00">a</text>
+</g>
+</g>
+</svg>`
+
+// mermaidSVG is trimmed Mermaid output: the theme lives in an embedded
+// stylesheet keyed by the root id.
+const mermaidSVG = `<svg id="my-svg" width="100%" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 50"><style>#my-svg{font-family:"trebuchet ms";fill:#333;background-color:white;}#my-svg .node rect{fill:#ECECFF;stroke:#9370DB;stroke-width:1px;}</style><g><rect class="basic" x="0" y="0" width="40" height="20"/></g></svg>`
+
+// d2SVG opens with a white rect covering the canvas.
+const d2SVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="-101 -101 300 200"><rect x="-101" y="-101" width="300" height="200" fill="#FFFFFF" stroke-width="0"/><rect x="0" y="0" width="50" height="30" style="fill:#FFFFFF;stroke:#0D32B2"/><text x="10" y="20" fill="#0A0F25">a</text></svg>`
+
+func TestApplyTheme_RemovesBackgrounds(t *testing.T) {
+	for _, theme := range []Theme{ThemeLight, ThemeDark, ThemeAuto} {
+		if got := ApplyTheme(graphvizSVG, theme); strings.Contains(got, `<polygon fill="white"`) {
+			t.Errorf("%s: Graphviz canvas polygon kept:\n%s", theme, got)
+		}
+		if got := ApplyTheme(mermaidSVG, theme); strings.Contains(got, "background-color") {
+			t.Errorf("%s: Mermaid root background kept:\n%s", theme, got)
+		}
+		got := ApplyTheme(d2SVG, theme)
+		if strings.Contains(got, `width="300"`) {
+			t.Errorf("%s: D2 background rect kept:\n%s", theme, got)
+		}
+		if !strings.Contains(got, `<rect x="0" y="0" width="50"`) {
+			t.Errorf("%s: D2 shape removed:\n%s", theme, got)
+		}
+	}
+}
+
+func TestApplyTheme_Light(t *testing.T) {
+	got := ApplyTheme(graphvizSVG, ThemeLight)
+	if !strings.Contains(got, `<ellipse fill="none" stroke="black"`) || strings.Contains(got, "<style>") {
+		t.Errorf("light theme recolored the diagram:\n%s", got)
+	}
+	if !strings.HasPrefix(got, `<?xml version="1.0"`) || !strings.Contains(got, "<!-- Generated by graphviz -->") {
+		t.Errorf("prolog or comment lost:\n%s", got)
+	}
+}
+
+func TestApplyTheme_Dark(t *testing.T) {
+	got := ApplyTheme(graphvizSVG, ThemeDark)
+	for _, want := range []string{
+		`<ellipse fill="none" stroke="#e6e6e6"`,
+		`<text text-anchor="middle" x="27" y="-86.3" font-family="Times,serif" font-size="14.00" fill="#e6e6e6">a</text>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Graphviz output lacks %s:\n%s", want, got)
+		}
+	}
+
+	got = ApplyTheme(mermaidSVG, ThemeDark)
+	for _, want := range []string{"fill:#e6e6e6", "#my-svg .node rect{fill:#2b2b2b;stroke:#9370DB;"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Mermaid stylesheet lacks %s:\n%s", want, got)
+		}
+	}
+
+	got = ApplyTheme(d2SVG, ThemeDark)
+	for _, want := range []string{`style="fill:#2b2b2b;stroke:#0D32B2"`, `fill="#e6e6e6">a</text>`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("D2 output lacks %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestApplyTheme_Auto(t *testing.T) {
+	got := ApplyTheme(graphvizSVG, ThemeAuto)
+	if !strings.Contains(got, `stroke="black" cx="27" cy="-90" rx="27" ry="18" class="kroki-fg-stroke"`) {
+		t.Errorf("black stroke not marked:\n%s", got)
+	}
+	if !strings.Contains(got, `class="kroki-fg-fill">a</text>`) {
+		t.Errorf("unfilled text not marked:\n%s", got)
+	}
+	i := strings.Index(got, "<svg ")
+	j := strings.Index(got, "<style>@media (prefers-color-scheme: dark){.kroki-fg-fill{fill:#e6e6e6 !important}")
+	if i < 0 || j < i {
+		t.Errorf("no media query stylesheet after the root tag:\n%s", got)
+	}
+
+	got = ApplyTheme(mermaidSVG, ThemeAuto)
+	if !strings.Contains(got, "#my-svg .node rect{fill:#ECECFF;") {
+		t.Errorf("light rendering of the stylesheet changed:\n%s", got)
+	}
+	if !strings.Contains(got, "#my-svg .node rect{fill:#2b2b2b !important}") {
+		t.Errorf("stylesheet remapping missing from the media query:\n%s", got)
+	}
+
+	// Text colored by a stylesheet class keeps the engine's color.
+	got = ApplyTheme(`<svg xmlns="http://www.w3.org/2000/svg"><style>.d2-1 .fill-B1{fill:#0D32B2}</style>`+
+		`<text class="text fill-B1">a</text><text class="text">b</text></svg>`, ThemeAuto)
+	if !strings.Contains(got, `<text class="text fill-B1">a</text>`) || !strings.Contains(got, `<text class="text kroki-fg-fill">b</text>`) {
+		t.Errorf("stylesheet-colored text marked, or other text not:\n%s", got)
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	if theme, err := ParseTheme(" Dark "); err != nil || theme != ThemeDark {
+		t.Errorf("ParseTheme(Dark) = %q, %v", theme, err)
+	}
+	if _, err := ParseTheme("sepia"); err == nil {
+		t.Error("ParseTheme(sepia) succeeded")
+	}
+}
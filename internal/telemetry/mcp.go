@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MCPTracer adapts Tracer to mcp-go, for server.WithTracer.
+func MCPTracer() tracing.Tracer { return mcpTracer{} }
+
+// MCPPropagator reads trace context from the HTTP headers of MCP requests,
+// for server.WithPropagator.
+func MCPPropagator() tracing.Propagator { return mcpPropagator{} }
+
+// MCPMetaPropagator reads trace context from the _meta of MCP requests
+// (traceparent, tracestate and baggage keys), for server.WithMetaPropagator.
+// Unlike headers, _meta reaches the server on every transport, stdio
+// included.
+func MCPMetaPropagator() tracing.MetaPropagator { return mcpPropagator{} }
+
+type mcpTracer struct{}
+
+var spanKinds = map[tracing.SpanKind]trace.SpanKind{
+	tracing.SpanKindServer:   trace.SpanKindServer,
+	tracing.SpanKindClient:   trace.SpanKindClient,
+	tracing.SpanKindInternal: trace.SpanKindInternal,
+}
+
+func (mcpTracer) Start(ctx context.Context, name string, kind tracing.SpanKind, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	kv := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		kv[i] = attribute.String(a.Key, a.Value)
+	}
+	ctx, span := Start(ctx, name, trace.WithSpanKind(spanKinds[kind]), trace.WithAttributes(kv...))
+	s := mcpSpan{span}
+	return tracing.ContextWithSpan(ctx, s), s
+}
+
+type mcpSpan struct{ span trace.Span }
+
+func (s mcpSpan) SetAttributes(attrs ...tracing.Attribute) {
+	for _, a := range attrs {
+		s.span.SetAttributes(attribute.String(a.Key, a.Value))
+	}
+}
+
+func (s mcpSpan) RecordError(err error) { s.span.RecordError(err) }
+
+func (s mcpSpan) SetStatus(code tracing.StatusCode, description string) {
+	switch code {
+	case tracing.StatusOK:
+		s.span.SetStatus(codes.Ok, description)
+	case tracing.StatusError:
+		s.span.SetStatus(codes.Error, description)
+	}
+}
+
+func (s mcpSpan) End() { s.span.End() }
+
+type mcpPropagator struct{}
+
+func (mcpPropagator) Inject(ctx context.Context, headers http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+}
+
+func (mcpPropagator) Extract(ctx context.Context, headers http.Header) context.Context {
+	// Trace context already taken from _meta wins over the headers.
+	if trace.SpanContextFromContext(ctx).IsValid() || headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(headers))
+}
+
+func (mcpPropagator) InjectMeta(ctx context.Context, meta *mcp.Meta) *mcp.Meta {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return meta
+	}
+	if meta == nil {
+		meta = &mcp.Meta{}
+	}
+	if meta.AdditionalFields == nil {
+		meta.AdditionalFields = map[string]any{}
+	}
+	for key, value := range carrier {
+		meta.AdditionalFields[key] = value
+	}
+	return meta
+}
+
+func (mcpPropagator) ExtractMeta(ctx context.Context, meta *mcp.Meta) context.Context {
+	if meta == nil {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{}
+	for key, value := range meta.AdditionalFields {
+		if s, ok := value.(string); ok {
+			carrier[key] = s
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
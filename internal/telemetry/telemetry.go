@@ -0,0 +1,114 @@
+// Package telemetry sets up OpenTelemetry tracing and adapts it to the
+// tracing interfaces of mcp-go.
+//
+// Instrumented code starts spans with Tracer, which follows the global
+// OpenTelemetry tracer provider: until Setup installs an exporter, spans are
+// no-ops and no trace context is propagated.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/utain/kroki-mcp"
+
+// Exporters are the values accepted by Options.Exporter.
+var Exporters = []string{"none", "otlp", "stdout"}
+
+// Options configures Setup.
+type Options struct {
+	// Exporter is "otlp" (OTLP over HTTP), "stdout", or "none" or empty to
+	// leave tracing disabled.
+	Exporter string
+	// Endpoint is the OTLP/HTTP endpoint URL, e.g. http://localhost:4318.
+	// Empty defers to the OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string
+	// SampleRatio is the fraction of new traces recorded. Traces started by
+	// a caller follow the caller's sampling decision.
+	SampleRatio float64
+	// ServiceVersion is reported as the service.version resource attribute
+	// when set.
+	ServiceVersion string
+	// Output receives the "stdout" exporter's spans. It defaults to
+	// os.Stderr, since stdout carries the MCP messages in stdio mode.
+	Output io.Writer
+}
+
+// Setup installs the global tracer provider and the W3C trace context and
+// baggage propagators described by opts. The returned function flushes
+// pending spans and must be called before the process exits. With tracing
+// disabled, Setup changes nothing and the returned function is a no-op.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	switch opts.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var exporterOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, exporterOpts...)
+	case "stdout":
+		out := opts.Output
+		if out == nil {
+			out = os.Stderr
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", "kroki-mcp")}
+	if opts.ServiceVersion != "" {
+		attrs = append(attrs, attribute.String("service.version", opts.ServiceVersion))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for kroki-mcp's own spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span with Tracer. It saves instrumented code the extra
+// import and call.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// restoreGlobals undoes Setup's changes to the global OpenTelemetry state
+// when the test ends.
+func restoreGlobals(t *testing.T) {
+	t.Helper()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+}
+
+func TestSetup_Disabled(t *testing.T) {
+	restoreGlobals(t)
+	before := otel.GetTracerProvider()
+	for _, exporter := range []string{"", "none"} {
+		shutdown, err := Setup(context.Background(), Options{Exporter: exporter})
+		if err != nil {
+			t.Fatalf("Setup(%q): %v", exporter, err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	}
+	if otel.GetTracerProvider() != before {
+		t.Error("Setup with tracing disabled replaced the tracer provider")
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("Setup accepted an unknown exporter")
+	}
+}
+
+func TestSetup_Stdout(t *testing.T) {
+	restoreGlobals(t)
+	var out bytes.Buffer
+	shutdown, err := Setup(context.Background(), Options{Exporter: "stdout", SampleRatio: 1, ServiceVersion: "v1.2.3", Output: &out})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	_, span := Start(context.Background(), "kroki.RenderDiagram")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	for _, want := range []string{`"Name":"kroki.RenderDiagram"`, `"Value":"kroki-mcp"`, `"Value":"v1.2.3"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("exported spans do not contain %s:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestMCPMetaPropagator(t *testing.T) {
+	restoreGlobals(t)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	p := MCPMetaPropagator()
+
+	if ctx := p.ExtractMeta(context.Background(), nil); trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("ExtractMeta(nil) produced a span context")
+	}
+
+	meta := &mcp.Meta{AdditionalFields: map[string]any{"traceparent": traceparent, "progressToken": 1}}
+	ctx := p.ExtractMeta(context.Background(), meta)
+	sc := trace.SpanContextFromContext(ctx)
+	if got := sc.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("extracted trace ID = %q", got)
+	}
+	if !sc.IsRemote() || !sc.IsSampled() {
+		t.Errorf("extracted span context = %+v, want remote and sampled", sc)
+	}
+
+	injected := p.InjectMeta(ctx, nil)
+	if injected == nil || injected.AdditionalFields["traceparent"] != traceparent {
+		t.Errorf("InjectMeta = %+v, want traceparent %s", injected, traceparent)
+	}
+	if got := p.InjectMeta(context.Background(), nil); got != nil {
+		t.Errorf("InjectMeta without a span context = %+v, want nil", got)
+	}
+}
+
+func TestMCPPropagator_MetaWinsOverHeaders(t *testing.T) {
+	restoreGlobals(t)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx := MCPMetaPropagator().ExtractMeta(context.Background(),
+		&mcp.Meta{AdditionalFields: map[string]any{"traceparent": traceparent}})
+	headers := map[string][]string{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}
+	ctx = MCPPropagator().Extract(ctx, headers)
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %q, want the one from _meta", got)
+	}
+
+	ctx = MCPPropagator().Extract(context.Background(), headers)
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace ID = %q, want the one from the headers", got)
+	}
+}